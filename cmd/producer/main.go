@@ -11,7 +11,9 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"github.com/ratmirtech/techwb-l0/internal/events"
 	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/schemaregistry"
 	"github.com/segmentio/kafka-go"
 )
 
@@ -30,9 +32,28 @@ func main() {
 	topic := env("KAFKA_TOPIC", "orders")
 
 	order := generateOrder()
-	msg, err := json.Marshal(order)
+	var msg []byte
+	var err error
+	contentType := events.ContentTypeJSON
+	switch format := env("PRODUCER_FORMAT", "json"); {
+	case format == "protobuf":
+		contentType = events.ContentTypeProtobuf
+		msg, err = events.EncodeProtobuf(order)
+	case format == "avro":
+		registryURL := os.Getenv("SCHEMA_REGISTRY_URL")
+		if registryURL == "" {
+			log.Fatalf("SCHEMA_REGISTRY_URL is required for avro")
+		}
+		contentType = events.ContentTypeAvro
+		avroCodec := events.NewAvro(schemaregistry.New(registryURL), topic+"-value")
+		msg, err = avroCodec.Encode(context.Background(), order)
+	case env("PRODUCER_ENVELOPE", "true") == "true":
+		msg, err = events.Wrap(events.OrderCreated, "producer", order)
+	default:
+		msg, err = json.Marshal(order)
+	}
 	if err != nil {
-		log.Fatalf("Can't make JSON: %v", err)
+		log.Fatalf("Can't encode order: %v", err)
 	}
 
 	writer := &kafka.Writer{
@@ -46,7 +67,11 @@ func main() {
 	defer writer.Close()
 
 	if err := writer.WriteMessages(context.Background(),
-		kafka.Message{Value: msg}); err != nil {
+		kafka.Message{
+			Key:     []byte(order.OrderUID),
+			Value:   msg,
+			Headers: []kafka.Header{{Key: events.HeaderContentType, Value: []byte(contentType)}},
+		}); err != nil {
 		log.Fatalf("Can't send to Kafka: %v", err)
 	}
 	log.Printf("Sent order with ID: %s", order.OrderUID)
@@ -74,11 +99,11 @@ func generateOrder() models.Order {
 			Transaction:  uid,
 			Currency:     "USD",
 			Provider:     "testpay",
-			Amount:       1000,
+			Amount:       650,
 			PaymentDt:    time.Now().Unix(),
 			Bank:         "testbank",
 			DeliveryCost: 200,
-			GoodsTotal:   800,
+			GoodsTotal:   450,
 			CustomFee:    0,
 		},
 		Items: []models.Item{
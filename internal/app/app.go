@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/ratmirtech/techwb-l0/internal/cache"
@@ -28,32 +29,79 @@ func Run(ctx context.Context) {
 	}
 	defer pg.Close()
 
-	c := cache.New()
-	if err := c.WarmUp(ctx, pg); err != nil {
-		log.Warn().Err(err).Msg("cache warmup")
-	} else {
+	c, err := cache.Open(cache.Options{
+		Backend:    cfg.CacheBackend,
+		Shards:     cfg.CacheShards,
+		MaxEntries: cfg.CacheMaxEntries,
+		MaxBytes:   cfg.CacheMaxBytes,
+		Policy:     cfg.CachePolicy,
+		TTL:        cfg.CacheTTL,
+		StaleTTL:   cfg.CacheStaleTTL,
+		Refresh:    pg.GetOrder,
+		LogSample:  uint32(max(cfg.CacheLogSample, 0)),
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("cache init")
+	}
+	go cache.RunJanitor(ctx, c, cfg.CacheJanitorEvery)
+	var warmed atomic.Bool
+	warmUp := func() {
+		var err error
+		if cfg.CacheSnapshotPath != "" {
+			err = cache.Restore(ctx, c, pg, cfg.CacheSnapshotPath, cfg.CacheWarmUpPageSize)
+		} else {
+			err = cache.WarmUp(ctx, c, pg, cfg.CacheWarmUpPageSize)
+		}
+		if err != nil {
+			log.Warn().Err(err).Msg("cache warmup")
+			return
+		}
 		log.Info().Int("orders", c.Len()).Msg("cache warmed")
+		warmed.Store(true)
+		go cache.RunSnapshots(ctx, c, cfg.CacheSnapshotPath, cfg.CacheSnapshotEvery)
+	}
+	if cfg.CacheWarmUpAsync {
+		log.Info().Msg("cache warmup continues in background")
+		go warmUp()
+	} else {
+		warmUp()
 	}
 
-	srv := httpapi.New(c, pg)
+	neg := cache.NewNegative(cfg.CacheNegativeMax, cfg.CacheNegativeTTL)
+	if cfg.AdminToken == "" {
+		log.Warn().Msg("ADMIN_TOKEN is empty: cache admin endpoints are open, flagged and rejected order endpoints are disabled")
+	}
+	consumer := kafka.NewConsumer(cfg, pg, c, neg)
+	srv := httpapi.New(c, pg, cache.NewLoader(c, neg, pg.GetOrder), consumer, cfg.AdminToken)
 	httpServer := &http.Server{
 		Addr:              cfg.HTTPAddr,
 		Handler:           srv.Router(),
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
-	consumer := kafka.NewConsumer(cfg, pg, c)
+	if cfg.CacheInvalidation {
+		go runInvalidation(ctx, pg, c, neg, cfg.CacheWarmUpPageSize)
+	}
 
-	errCh := make(chan error, 2)
-	go func() { errCh <- consumer.Run(ctx) }()
+	consumerCtx, stopConsumer := context.WithCancel(ctx)
+	defer stopConsumer()
+	consumerDone := make(chan error, 1)
+	go func() { consumerDone <- consumer.Run(consumerCtx) }()
+	errCh := make(chan error, 1)
 	go func() {
 		log.Info().Str("addr", cfg.HTTPAddr).Msg("http listen")
 		errCh <- httpServer.ListenAndServe()
 	}()
 
+	consumerRunning := true
 	select {
 	case <-ctx.Done():
 		log.Info().Msg("shutting down...")
+	case err := <-consumerDone:
+		consumerRunning = false
+		if err != nil {
+			log.Error().Err(err).Msg("fatal")
+		}
 	case err := <-errCh:
 		if err != nil && err != http.ErrServerClosed {
 			log.Error().Err(err).Msg("fatal")
@@ -63,7 +111,19 @@ func Run(ctx context.Context) {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	_ = httpServer.Shutdown(shutdownCtx)
+	if consumerRunning {
+		// let the consumer finish in-flight messages before its reader is closed
+		stopConsumer()
+		<-consumerDone
+	}
 	consumer.Close()
+	if cfg.CacheSnapshotPath != "" && warmed.Load() {
+		if n, err := cache.SaveSnapshot(c, cfg.CacheSnapshotPath); err != nil {
+			log.Error().Err(err).Msg("cache snapshot")
+		} else {
+			log.Info().Int("orders", n).Msg("cache snapshot saved")
+		}
+	}
 	log.Info().Msg("bye")
 	os.Exit(0)
 }
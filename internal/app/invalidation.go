@@ -0,0 +1,89 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/cache"
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/repo"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	listenMinBackoff = time.Second
+	listenMaxBackoff = 30 * time.Second
+	// resyncSkew widens the resync window after a reconnect to cover clock drift.
+	resyncSkew = time.Minute
+)
+
+// runInvalidation keeps this instance's cache in line with writes made by other
+// replicas. After a lost connection it reloads orders changed while it was away.
+func runInvalidation(ctx context.Context, pg *repo.PG, c cache.OrderCache, neg *cache.Negative, pageSize int) {
+	backoff := listenMinBackoff
+	var lostAt time.Time
+	for {
+		err := pg.ListenOrderChanges(ctx, func() {
+			backoff = listenMinBackoff
+			log.Info().Msg("listening for order changes")
+			// a failed resync keeps lostAt, so the next connection retries the whole gap
+			if !lostAt.IsZero() && resync(ctx, pg, c, neg, lostAt.Add(-resyncSkew), pageSize) == nil {
+				lostAt = time.Time{}
+			}
+		}, func(ch repo.OrderChange) {
+			if ch.Origin == pg.InstanceID() {
+				return
+			}
+			refresh(ctx, pg, c, neg, ch.OrderUID)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if lostAt.IsZero() {
+			lostAt = time.Now()
+		}
+		log.Warn().Err(err).Dur("retry_in", backoff).Msg("order change listener disconnected")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, listenMaxBackoff)
+	}
+}
+
+func refresh(ctx context.Context, pg *repo.PG, c cache.OrderCache, neg *cache.Negative, id string) {
+	o, err := pg.GetOrder(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		c.Delete(id)
+		return
+	}
+	if err != nil {
+		// a stale entry is worse than a miss
+		c.Delete(id)
+		log.Warn().Err(err).Str("order_uid", id).Msg("refresh changed order")
+		return
+	}
+	c.Set(o)
+	neg.Forget(id)
+}
+
+func resync(ctx context.Context, pg *repo.PG, c cache.OrderCache, neg *cache.Negative, since time.Time, pageSize int) error {
+	n := 0
+	err := pg.EachChangedOrdersPage(ctx, since, pageSize, func(orders []models.Order) error {
+		for _, o := range orders {
+			c.Set(o)
+			neg.Forget(o.OrderUID)
+		}
+		n += len(orders)
+		return nil
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("resync changed orders")
+		return err
+	}
+	log.Info().Int("orders", n).Time("since", since).Msg("resynced changed orders")
+	return nil
+}
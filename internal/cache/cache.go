@@ -2,39 +2,243 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/ratmirtech/techwb-l0/internal/models"
 	"github.com/ratmirtech/techwb-l0/internal/repo"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+const refreshTimeout = 5 * time.Second
+
+const (
+	BackendMap     = "map"
+	BackendSharded = "sharded"
+	BackendNoop    = "noop"
+)
+
+type OrderCache interface {
+	Get(id string) (models.Order, bool)
+	Set(o models.Order)
+	// SetWithTTL stores o with its own lifetime; a zero ttl never expires.
+	SetWithTTL(o models.Order, ttl time.Duration)
+	Delete(id string)
+	Len() int
+	// Range calls fn for every live order until fn returns false.
+	// fn must not call back into the cache.
+	Range(fn func(models.Order) bool)
+	Stats() Stats
+	// Clear drops every entry but keeps the counters.
+	Clear()
+
+	GetByTrackNumber(track string) (models.Order, bool)
+	ByCustomer(customerID string) []models.Order
+	ByNmID(nmID int) []models.Order
+	ByChrtID(chrtID int) []models.Order
+}
+
+type RefreshFunc func(ctx context.Context, id string) (models.Order, error)
+
+type Options struct {
+	Backend string
+	Shards  int
+
+	MaxEntries int
+	MaxBytes   int64
+	Policy     string
+
+	// TTL is the default lifetime of an entry, zero keeps entries forever.
+	TTL time.Duration
+	// StaleTTL is how long an expired entry is still served while Refresh reloads it.
+	StaleTTL time.Duration
+	Refresh  RefreshFunc
+
+	// LogSample logs one in every LogSample hit, miss, set and eviction events at
+	// debug level; the counters in Stats see all of them.
+	LogSample uint32
+}
+
+type entry struct {
+	order     models.Order
+	size      int64
+	expiresAt time.Time
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
 type Store struct {
-	mu sync.RWMutex
-	m  map[string]models.Order
+	mu     sync.RWMutex
+	m      map[string]entry
+	idx    index
+	bytes  int64
+	policy policy // nil when the store is unbounded
+
+	policyName string
+	maxEntries int
+	maxBytes   int64
+	counters   counters
+	warmUp     warmUpInfo
+	events     zerolog.Logger
+
+	ttl        time.Duration
+	staleTTL   time.Duration
+	refresh    RefreshFunc
+	refreshing map[string]struct{}
+}
+
+// Open builds the cache backend selected by opts.Backend.
+func Open(opts Options) (OrderCache, error) {
+	switch strings.ToLower(opts.Backend) {
+	case "", BackendMap:
+		return New(opts)
+	case BackendSharded:
+		return NewSharded(opts)
+	case BackendNoop:
+		return Noop{}, nil
+	}
+	return nil, fmt.Errorf("unknown cache backend %q", opts.Backend)
 }
 
-func New() *Store {
-	return &Store{m: make(map[string]models.Order)}
+func New(opts Options) (*Store, error) {
+	s := &Store{
+		m:          make(map[string]entry),
+		idx:        newIndex(),
+		policyName: opts.Policy,
+		maxEntries: opts.MaxEntries,
+		maxBytes:   opts.MaxBytes,
+		ttl:        opts.TTL,
+		staleTTL:   opts.StaleTTL,
+		refresh:    opts.Refresh,
+		refreshing: make(map[string]struct{}),
+		events:     log.Logger,
+	}
+	if opts.LogSample > 1 {
+		s.events = log.Logger.Sample(&zerolog.BasicSampler{N: opts.LogSample})
+	}
+	if s.bounded() {
+		p, err := newPolicy(opts.Policy)
+		if err != nil {
+			return nil, err
+		}
+		s.policy = p
+	}
+	return s, nil
 }
 
+func (s *Store) bounded() bool { return s.maxEntries > 0 || s.maxBytes > 0 }
+
 func (s *Store) Get(id string) (models.Order, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	o, ok := s.m[id]
+	now := time.Now()
+	e, ok := s.load(id)
+	if ok && e.expired(now) {
+		if s.refresh != nil && now.Before(e.expiresAt.Add(s.staleTTL)) {
+			s.revalidate(id, e.expiresAt)
+		} else {
+			s.mu.Lock()
+			s.expireLocked(id, now)
+			s.mu.Unlock()
+			ok = false
+		}
+	}
 	if ok {
-		log.Info().Str("order_uid", id).Msg("Found order in cache")
+		s.counters.hits.Add(1)
+		s.events.Debug().Str("order_uid", id).Msg("Cache hit")
 	} else {
-		log.Warn().Str("order_uid", id).Msg("Order not found in cache")
+		s.counters.misses.Add(1)
+		s.events.Debug().Str("order_uid", id).Msg("Cache miss")
 	}
-	return o, ok
+	return e.order, ok
+}
+
+func (s *Store) load(id string) (entry, bool) {
+	if s.policy == nil {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		e, ok := s.m[id]
+		return e, ok
+	}
+	// recording the access reorders the policy, so a bounded store needs the write lock
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.m[id]
+	if ok {
+		s.policy.access(id)
+	}
+	return e, ok
 }
 
 func (s *Store) Set(o models.Order) {
+	s.SetWithTTL(o, s.ttl)
+}
+
+// SetWithTTL stores o with its own lifetime; a zero ttl never expires.
+func (s *Store) SetWithTTL(o models.Order, ttl time.Duration) {
 	s.mu.Lock()
-	s.m[o.OrderUID] = o
+	s.setLocked(o, ttl)
+	s.evictLocked()
 	s.mu.Unlock()
-	log.Info().Str("order_uid", o.OrderUID).Msg("Saved order to cache")
+	s.counters.sets.Add(1)
+	s.events.Debug().Str("order_uid", o.OrderUID).Msg("Cache set")
+}
+
+// revalidate reloads a stale entry in the background. stale identifies the
+// entry, so a Set or Delete that lands during the reload is not overwritten.
+func (s *Store) revalidate(id string, stale time.Time) {
+	s.mu.Lock()
+	if _, ok := s.refreshing[id]; ok {
+		s.mu.Unlock()
+		return
+	}
+	s.refreshing[id] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.refreshing, id)
+			s.mu.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+		o, err := s.refresh(ctx, id)
+		if err != nil && !errors.Is(err, repo.ErrNotFound) {
+			log.Warn().Err(err).Str("order_uid", id).Msg("Failed to refresh stale order")
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if cur, ok := s.m[id]; !ok || !cur.expiresAt.Equal(stale) {
+			return
+		}
+		if err != nil {
+			s.removeLocked(id)
+			return
+		}
+		s.setLocked(o, s.ttl)
+		s.evictLocked()
+		s.counters.sets.Add(1)
+	}()
+}
+
+func (s *Store) sweep(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, e := range s.m {
+		if e.expired(now.Add(-s.staleTTL)) {
+			s.removeLocked(id)
+			s.counters.expired.Add(1)
+			n++
+		}
+	}
+	return n
 }
 
 func (s *Store) Len() int {
@@ -43,17 +247,160 @@ func (s *Store) Len() int {
 	return len(s.m)
 }
 
-func (s *Store) WarmUp(ctx context.Context, r *repo.PG) error {
-	orders, err := r.GetAllOrders(ctx)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to load orders from DB")
-		return err
+func (s *Store) Delete(id string) {
+	s.mu.Lock()
+	s.removeLocked(id)
+	s.mu.Unlock()
+}
+
+func (s *Store) Range(fn func(models.Order) bool) {
+	live := time.Now().Add(-s.staleTTL)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, e := range s.m {
+		if e.expired(live) {
+			continue
+		}
+		if !fn(e.order) {
+			return
+		}
+	}
+}
+
+// GetByTrackNumber returns the newest order carrying track.
+func (s *Store) GetByTrackNumber(track string) (models.Order, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	orders := s.collectLocked(s.idx.byTrack[track])
+	if len(orders) == 0 {
+		return models.Order{}, false
+	}
+	return orders[0], true
+}
+
+func (s *Store) ByCustomer(customerID string) []models.Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.collectLocked(s.idx.byCustomer[customerID])
+}
+
+func (s *Store) ByNmID(nmID int) []models.Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.collectLocked(s.idx.byNmID[nmID])
+}
+
+func (s *Store) ByChrtID(chrtID int) []models.Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.collectLocked(s.idx.byChrtID[chrtID])
+}
+
+func (s *Store) collectLocked(ids idSet) []models.Order {
+	live := time.Now().Add(-s.staleTTL)
+	out := make([]models.Order, 0, len(ids))
+	for id := range ids {
+		if e, ok := s.m[id]; ok && !e.expired(live) {
+			out = append(out, e.order)
+		}
+	}
+	sortOrders(out)
+	return out
+}
+
+func (s *Store) Stats() Stats {
+	s.mu.RLock()
+	st := Stats{Entries: len(s.m), Bytes: s.bytes}
+	s.mu.RUnlock()
+	s.counters.fill(&st)
+	s.warmUp.fill(&st)
+	return st
+}
+
+func (s *Store) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m = make(map[string]entry)
+	s.idx = newIndex()
+	s.bytes = 0
+	if s.policy != nil {
+		s.policy, _ = newPolicy(s.policyName)
+	}
+}
+
+func (s *Store) recordWarmUp(orders int, d time.Duration) { s.warmUp.record(orders, d) }
+
+func (s *Store) setLocked(o models.Order, ttl time.Duration) {
+	e := entry{order: o, size: approxSize(o)}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+	if old, ok := s.m[o.OrderUID]; ok {
+		s.bytes -= old.size
+		s.idx.remove(old.order)
+		if s.policy != nil {
+			s.policy.access(o.OrderUID)
+		}
+	} else if s.policy != nil {
+		s.policy.add(o.OrderUID)
+	}
+	s.m[o.OrderUID] = e
+	s.idx.add(o)
+	s.bytes += e.size
+}
+
+func (s *Store) evictLocked() {
+	if s.policy == nil {
+		return
+	}
+	for (s.maxEntries > 0 && len(s.m) > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		id, ok := s.policy.evict()
+		if !ok {
+			return
+		}
+		if s.dropLocked(id) {
+			s.counters.evictions.Add(1)
+			s.events.Debug().Str("order_uid", id).Msg("Cache eviction")
+		}
 	}
+}
+
+func (s *Store) removeLocked(id string) {
+	if s.dropLocked(id) && s.policy != nil {
+		s.policy.remove(id)
+	}
+}
+
+// dropLocked removes the entry from the map and indexes but not from the policy.
+func (s *Store) dropLocked(id string) bool {
+	e, ok := s.m[id]
+	if !ok {
+		return false
+	}
+	s.bytes -= e.size
+	delete(s.m, id)
+	s.idx.remove(e.order)
+	return true
+}
+
+// expireLocked rechecks the entry because a refresh may have replaced it meanwhile.
+func (s *Store) expireLocked(id string, now time.Time) {
+	if e, ok := s.m[id]; ok && e.expired(now) {
+		s.removeLocked(id)
+		s.counters.expired.Add(1)
+	}
+}
+
+// addMissing stores orders read from the database unless a live entry, which
+// may be newer than the read, is already there.
+func (s *Store) addMissing(orders []models.Order) {
+	now := time.Now()
 	s.mu.Lock()
+	defer s.mu.Unlock()
 	for _, o := range orders {
-		s.m[o.OrderUID] = o
+		if e, ok := s.m[o.OrderUID]; !ok || e.expired(now) {
+			s.setLocked(o, s.ttl)
+		}
 	}
-	s.mu.Unlock()
-	log.Info().Int("count", len(orders)).Msg("Loaded orders to cache")
-	return nil
+	s.evictLocked()
 }
@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestMain(m *testing.M) {
+	// keep the per-event debug logs from flooding test output, while still
+	// paying their formatting cost in benchmarks
+	log.Logger = zerolog.New(io.Discard)
+	os.Exit(m.Run())
+}
+
+// BenchmarkEventLogging compares logging every Get and Set, as the cache did at
+// info level, with the sampled debug events and with debug disabled.
+func BenchmarkEventLogging(b *testing.B) {
+	discard := zerolog.New(io.Discard)
+	for _, bc := range []struct {
+		name   string
+		events zerolog.Logger
+	}{
+		{"every-event", discard},
+		{"sampled-100", discard.Sample(&zerolog.BasicSampler{N: 100})},
+		{"debug-off", discard.Level(zerolog.InfoLevel)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			s, err := New(Options{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			s.events = bc.events
+			o := models.Order{OrderUID: "b563feb7b2b84b6test"}
+			for b.Loop() {
+				s.Set(o)
+				s.Get(o.OrderUID)
+			}
+		})
+	}
+}
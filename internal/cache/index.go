@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+type idSet map[string]struct{}
+
+// index maps secondary keys to order_uids. It is owned by a Store and only
+// touched under the store lock, together with the primary map.
+type index struct {
+	byTrack    map[string]idSet // track numbers are not unique across orders
+	byCustomer map[string]idSet
+	byNmID     map[int]idSet
+	byChrtID   map[int]idSet
+}
+
+func newIndex() index {
+	return index{
+		byTrack:    make(map[string]idSet),
+		byCustomer: make(map[string]idSet),
+		byNmID:     make(map[int]idSet),
+		byChrtID:   make(map[int]idSet),
+	}
+}
+
+func (ix index) add(o models.Order) {
+	if o.TrackNumber != "" {
+		link(ix.byTrack, o.TrackNumber, o.OrderUID)
+	}
+	if o.CustomerID != "" {
+		link(ix.byCustomer, o.CustomerID, o.OrderUID)
+	}
+	for _, it := range o.Items {
+		link(ix.byNmID, it.NmID, o.OrderUID)
+		link(ix.byChrtID, it.ChrtID, o.OrderUID)
+	}
+}
+
+func (ix index) remove(o models.Order) {
+	unlink(ix.byTrack, o.TrackNumber, o.OrderUID)
+	unlink(ix.byCustomer, o.CustomerID, o.OrderUID)
+	for _, it := range o.Items {
+		unlink(ix.byNmID, it.NmID, o.OrderUID)
+		unlink(ix.byChrtID, it.ChrtID, o.OrderUID)
+	}
+}
+
+func link[K comparable](m map[K]idSet, k K, id string) {
+	set, ok := m[k]
+	if !ok {
+		set = make(idSet)
+		m[k] = set
+	}
+	set[id] = struct{}{}
+}
+
+func unlink[K comparable](m map[K]idSet, k K, id string) {
+	set, ok := m[k]
+	if !ok {
+		return
+	}
+	delete(set, id)
+	if len(set) == 0 {
+		delete(m, k)
+	}
+}
+
+// sortOrders gives lookups a stable order: newest first, then by order_uid.
+func sortOrders(orders []models.Order) {
+	slices.SortFunc(orders, func(a, b models.Order) int {
+		if c := b.DateCreated.Compare(a.DateCreated); c != 0 {
+			return c
+		}
+		return strings.Compare(a.OrderUID, b.OrderUID)
+	})
+}
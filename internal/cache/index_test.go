@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+func TestSharedTrackNumber(t *testing.T) {
+	now := time.Now()
+	older := models.Order{OrderUID: "a", TrackNumber: "T", DateCreated: now.Add(-time.Hour)}
+	newer := models.Order{OrderUID: "b", TrackNumber: "T", DateCreated: now}
+
+	for name, open := range map[string]func() (OrderCache, error){
+		"map":     func() (OrderCache, error) { return New(Options{}) },
+		"sharded": func() (OrderCache, error) { return NewSharded(Options{}) },
+	} {
+		c, err := open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Set(newer)
+		c.Set(older)
+		if o, ok := c.GetByTrackNumber("T"); !ok || o.OrderUID != "b" {
+			t.Fatalf("%s: got %q, %v, want the newest order", name, o.OrderUID, ok)
+		}
+		// dropping one order must not unindex the other
+		c.Delete("b")
+		if o, ok := c.GetByTrackNumber("T"); !ok || o.OrderUID != "a" {
+			t.Fatalf("%s: after delete got %q, %v", name, o.OrderUID, ok)
+		}
+		c.Delete("a")
+		if _, ok := c.GetByTrackNumber("T"); ok {
+			t.Fatalf("%s: track still indexed after deleting every order", name)
+		}
+	}
+}
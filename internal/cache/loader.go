@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/repo"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+)
+
+const loadTimeout = 5 * time.Second
+
+type LoaderStats struct {
+	Calls       uint64 `json:"calls"`
+	Queries     uint64 `json:"queries"`
+	Coalesced   uint64 `json:"coalesced"`
+	NegativeHit uint64 `json:"negative_hits"`
+	NegativeLen int    `json:"negative_entries"`
+}
+
+// Loader reads orders missing from the cache through to the database. Concurrent
+// misses for the same id share a single query and its result.
+type Loader struct {
+	cache    OrderCache
+	negative *Negative
+	load     RefreshFunc
+	group    singleflight.Group
+
+	calls        atomic.Uint64
+	queries      atomic.Uint64
+	negativeHits atomic.Uint64
+}
+
+func NewLoader(c OrderCache, neg *Negative, load RefreshFunc) *Loader {
+	return &Loader{cache: c, negative: neg, load: load}
+}
+
+// Load returns repo.ErrNotFound for ids the database does not know.
+func (l *Loader) Load(ctx context.Context, id string) (models.Order, error) {
+	l.calls.Add(1)
+	if l.negative.Has(id) {
+		l.negativeHits.Add(1)
+		return models.Order{}, repo.ErrNotFound
+	}
+	ch := l.group.DoChan(id, func() (any, error) {
+		l.queries.Add(1)
+		gen := l.negative.Generation(id)
+		// detached from the first caller so its cancellation does not fail the others
+		qctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+		o, err := l.load(qctx, id)
+		if err != nil {
+			if errors.Is(err, repo.ErrNotFound) {
+				l.negative.Add(id, gen)
+			}
+			return models.Order{}, err
+		}
+		// the consumer may have cached a newer version while the query ran
+		fill(l.cache, []models.Order{o})
+		return o, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return models.Order{}, ctx.Err()
+	case res := <-ch:
+		if res.Shared {
+			log.Debug().Str("order_uid", id).Msg("Shared in-flight order load")
+		}
+		if res.Err != nil {
+			return models.Order{}, res.Err
+		}
+		return res.Val.(models.Order), nil
+	}
+}
+
+func (l *Loader) Stats() LoaderStats {
+	st := LoaderStats{
+		Calls:       l.calls.Load(),
+		Queries:     l.queries.Load(),
+		NegativeHit: l.negativeHits.Load(),
+		NegativeLen: l.negative.Len(),
+	}
+	if st.Calls > st.Queries+st.NegativeHit {
+		st.Coalesced = st.Calls - st.Queries - st.NegativeHit
+	}
+	return st
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/repo"
+)
+
+func TestLoaderSkipsNegativeForgottenDuringLoad(t *testing.T) {
+	c, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	neg := NewNegative(10, time.Minute)
+	saved := false
+	l := NewLoader(c, neg, func(ctx context.Context, id string) (models.Order, error) {
+		if saved {
+			return models.Order{OrderUID: id}, nil
+		}
+		// the order is saved, and forgotten, while the miss is on its way back
+		saved = true
+		neg.Forget(id)
+		return models.Order{}, repo.ErrNotFound
+	})
+
+	if _, err := l.Load(context.Background(), "a"); !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("first load: %v", err)
+	}
+	if neg.Has("a") {
+		t.Fatal("stale miss was remembered after Forget")
+	}
+	if _, err := l.Load(context.Background(), "a"); err != nil {
+		t.Fatalf("second load: %v", err)
+	}
+}
+
+func TestLoaderRemembersMisses(t *testing.T) {
+	c, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	neg := NewNegative(10, time.Minute)
+	queries := 0
+	l := NewLoader(c, neg, func(context.Context, string) (models.Order, error) {
+		queries++
+		return models.Order{}, repo.ErrNotFound
+	})
+	for range 3 {
+		if _, err := l.Load(context.Background(), "a"); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatal(err)
+		}
+	}
+	if queries != 1 {
+		t.Fatalf("queried %d times, want 1", queries)
+	}
+	neg.Forget("a")
+	_, _ = l.Load(context.Background(), "a")
+	if queries != 2 {
+		t.Fatalf("queried %d times after Forget, want 2", queries)
+	}
+}
+
+func TestLoaderCoalescesConcurrentLoads(t *testing.T) {
+	c, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queries atomic.Int32
+	release := make(chan struct{})
+	l := NewLoader(c, NewNegative(10, time.Minute), func(_ context.Context, id string) (models.Order, error) {
+		queries.Add(1)
+		<-release
+		return models.Order{OrderUID: id}, nil
+	})
+
+	const callers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := l.Load(context.Background(), "a")
+			errs <- err
+		}()
+	}
+	// every caller is counted before it joins the query
+	eventually(t, "callers to join", func() bool { return l.Stats().Calls == callers })
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := queries.Load(); n != 1 {
+		t.Fatalf("ran %d queries, want 1", n)
+	}
+	if st := l.Stats(); st.Queries != 1 || st.Coalesced != callers-1 {
+		t.Fatalf("stats %+v, want 1 query and %d coalesced", st, callers-1)
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("loaded order not cached")
+	}
+}
+
+func TestLoaderKeepsNewerCachedOrder(t *testing.T) {
+	c, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLoader(c, NewNegative(10, time.Minute), func(_ context.Context, id string) (models.Order, error) {
+		// the consumer caches a newer version while the query runs
+		c.Set(models.Order{OrderUID: id, TrackNumber: "new"})
+		return models.Order{OrderUID: id, TrackNumber: "old"}, nil
+	})
+	if _, err := l.Load(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if o, _ := c.Get("a"); o.TrackNumber != "new" {
+		t.Fatalf("cache holds %q, want the newer order", o.TrackNumber)
+	}
+}
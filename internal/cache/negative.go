@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+// negStripes bounds the generation counters; ids sharing a stripe only cost an
+// occasional skipped Add.
+const negStripes = 256
+
+type negEntry struct {
+	id        string
+	expiresAt time.Time
+}
+
+// Negative remembers ids the database did not know about, so repeated lookups of
+// unknown orders are answered without a query until ttl passes or the order is saved.
+// A non-positive size or ttl disables it.
+type Negative struct {
+	mu    sync.Mutex
+	max   int
+	ttl   time.Duration
+	ll    *list.List // oldest at the back
+	items map[string]*list.Element
+	seed  maphash.Seed
+	gens  [negStripes]uint64 // bumped by Forget, see Generation
+}
+
+func NewNegative(max int, ttl time.Duration) *Negative {
+	return &Negative{max: max, ttl: ttl, ll: list.New(), items: make(map[string]*list.Element), seed: maphash.MakeSeed()}
+}
+
+func (n *Negative) enabled() bool { return n.max > 0 && n.ttl > 0 }
+
+func (n *Negative) Has(id string) bool {
+	if !n.enabled() {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	el, ok := n.items[id]
+	if !ok {
+		return false
+	}
+	if time.Now().After(el.Value.(negEntry).expiresAt) {
+		n.ll.Remove(el)
+		delete(n.items, id)
+		return false
+	}
+	return true
+}
+
+func (n *Negative) stripe(id string) *uint64 {
+	return &n.gens[maphash.String(n.seed, id)%negStripes]
+}
+
+// Generation is taken before looking id up in the database and handed to Add,
+// so a Forget that lands while the query runs keeps the stale miss out.
+func (n *Negative) Generation(id string) uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return *n.stripe(id)
+}
+
+func (n *Negative) Add(id string, gen uint64) {
+	if !n.enabled() {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if *n.stripe(id) != gen {
+		return
+	}
+	e := negEntry{id: id, expiresAt: time.Now().Add(n.ttl)}
+	if el, ok := n.items[id]; ok {
+		el.Value = e
+		n.ll.MoveToFront(el)
+		return
+	}
+	n.items[id] = n.ll.PushFront(e)
+	for n.ll.Len() > n.max {
+		old := n.ll.Remove(n.ll.Back()).(negEntry)
+		delete(n.items, old.id)
+	}
+}
+
+func (n *Negative) Forget(id string) {
+	if !n.enabled() {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	*n.stripe(id)++
+	if el, ok := n.items[id]; ok {
+		n.ll.Remove(el)
+		delete(n.items, id)
+	}
+}
+
+func (n *Negative) Len() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ll.Len()
+}
@@ -0,0 +1,24 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+// Noop never stores anything, so every read falls through to the database.
+type Noop struct{}
+
+func (Noop) Get(string) (models.Order, bool)        { return models.Order{}, false }
+func (Noop) Set(models.Order)                       {}
+func (Noop) SetWithTTL(models.Order, time.Duration) {}
+func (Noop) Delete(string)                          {}
+func (Noop) Len() int                               { return 0 }
+func (Noop) Range(func(models.Order) bool)          {}
+func (Noop) Stats() Stats                           { return Stats{} }
+func (Noop) Clear()                                 {}
+
+func (Noop) GetByTrackNumber(string) (models.Order, bool) { return models.Order{}, false }
+func (Noop) ByCustomer(string) []models.Order             { return nil }
+func (Noop) ByNmID(int) []models.Order                    { return nil }
+func (Noop) ByChrtID(int) []models.Order                  { return nil }
@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+)
+
+const (
+	PolicyLRU = "lru"
+	PolicyLFU = "lfu"
+	Policy2Q  = "2q"
+)
+
+// policy tracks keys of a bounded store and picks eviction victims.
+// Implementations are not safe for concurrent use; the store serialises calls.
+type policy interface {
+	add(key string)
+	access(key string)
+	remove(key string)
+	evict() (string, bool)
+}
+
+func newPolicy(name string) (policy, error) {
+	switch strings.ToLower(name) {
+	case "", PolicyLRU:
+		return newLRU(), nil
+	case PolicyLFU:
+		return newLFU(), nil
+	case Policy2Q:
+		return newTwoQueue(), nil
+	}
+	return nil, fmt.Errorf("unknown cache eviction policy %q", name)
+}
+
+type lru struct {
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newLRU() *lru {
+	return &lru{ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (p *lru) add(key string) {
+	if el, ok := p.items[key]; ok {
+		p.ll.MoveToFront(el)
+		return
+	}
+	p.items[key] = p.ll.PushFront(key)
+}
+
+func (p *lru) access(key string) {
+	if el, ok := p.items[key]; ok {
+		p.ll.MoveToFront(el)
+	}
+}
+
+func (p *lru) remove(key string) {
+	if el, ok := p.items[key]; ok {
+		p.ll.Remove(el)
+		delete(p.items, key)
+	}
+}
+
+func (p *lru) evict() (string, bool) {
+	el := p.ll.Back()
+	if el == nil {
+		return "", false
+	}
+	key := p.ll.Remove(el).(string)
+	delete(p.items, key)
+	return key, true
+}
+
+type lfuItem struct {
+	key  string
+	freq int
+	el   *list.Element
+}
+
+// lfu keeps one LRU-ordered bucket per access frequency, so ties are broken by recency.
+type lfu struct {
+	items   map[string]*lfuItem
+	buckets map[int]*list.List
+	minFreq int
+}
+
+func newLFU() *lfu {
+	return &lfu{items: make(map[string]*lfuItem), buckets: make(map[int]*list.List)}
+}
+
+func (p *lfu) push(it *lfuItem) {
+	b, ok := p.buckets[it.freq]
+	if !ok {
+		b = list.New()
+		p.buckets[it.freq] = b
+	}
+	it.el = b.PushFront(it)
+}
+
+func (p *lfu) unlink(it *lfuItem) {
+	b := p.buckets[it.freq]
+	b.Remove(it.el)
+	if b.Len() == 0 {
+		delete(p.buckets, it.freq)
+	}
+}
+
+func (p *lfu) add(key string) {
+	if _, ok := p.items[key]; ok {
+		p.access(key)
+		return
+	}
+	it := &lfuItem{key: key, freq: 1}
+	p.items[key] = it
+	p.push(it)
+	p.minFreq = 1
+}
+
+func (p *lfu) access(key string) {
+	it, ok := p.items[key]
+	if !ok {
+		return
+	}
+	p.unlink(it)
+	it.freq++
+	p.push(it)
+}
+
+func (p *lfu) remove(key string) {
+	if it, ok := p.items[key]; ok {
+		p.unlink(it)
+		delete(p.items, key)
+	}
+}
+
+func (p *lfu) evict() (string, bool) {
+	if len(p.items) == 0 {
+		return "", false
+	}
+	// minFreq only grows between adds, so scanning upwards finds the lowest live bucket
+	for p.buckets[p.minFreq] == nil {
+		p.minFreq++
+	}
+	b := p.buckets[p.minFreq]
+	it := b.Back().Value.(*lfuItem)
+	p.unlink(it)
+	delete(p.items, it.key)
+	return it.key, true
+}
+
+const (
+	twoQueueInShare  = 4 // A1in holds up to 1/4 of the resident keys
+	twoQueueOutShare = 2 // A1out remembers up to 1/2 as many keys as are resident
+)
+
+// twoQueue is the full 2Q algorithm: new keys enter the FIFO A1in, keys evicted from
+// A1in are remembered in the ghost list A1out, and only keys seen again while in
+// A1out are promoted to the LRU-ordered Am.
+type twoQueue struct {
+	in, out, am *list.List
+	items       map[string]*list.Element
+	where       map[string]*list.List
+}
+
+func newTwoQueue() *twoQueue {
+	return &twoQueue{
+		in: list.New(), out: list.New(), am: list.New(),
+		items: make(map[string]*list.Element),
+		where: make(map[string]*list.List),
+	}
+}
+
+func (p *twoQueue) add(key string) {
+	if q, ok := p.where[key]; ok {
+		if q != p.out {
+			p.access(key)
+			return
+		}
+		p.out.Remove(p.items[key])
+		p.items[key] = p.am.PushFront(key)
+		p.where[key] = p.am
+		return
+	}
+	p.items[key] = p.in.PushFront(key)
+	p.where[key] = p.in
+}
+
+func (p *twoQueue) access(key string) {
+	if p.where[key] == p.am {
+		p.am.MoveToFront(p.items[key])
+	}
+}
+
+func (p *twoQueue) remove(key string) {
+	if q, ok := p.where[key]; ok {
+		q.Remove(p.items[key])
+		delete(p.items, key)
+		delete(p.where, key)
+	}
+}
+
+func (p *twoQueue) evict() (string, bool) {
+	resident := p.in.Len() + p.am.Len()
+	if resident == 0 {
+		return "", false
+	}
+	if p.in.Len() > 0 && (p.in.Len()*twoQueueInShare > resident || p.am.Len() == 0) {
+		key := p.in.Remove(p.in.Back()).(string)
+		p.items[key] = p.out.PushFront(key)
+		p.where[key] = p.out
+		for p.out.Len() > max(1, (resident-1)/twoQueueOutShare) {
+			ghost := p.out.Remove(p.out.Back()).(string)
+			delete(p.items, ghost)
+			delete(p.where, ghost)
+		}
+		return key, true
+	}
+	key := p.am.Remove(p.am.Back()).(string)
+	delete(p.items, key)
+	delete(p.where, key)
+	return key, true
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+// drain evicts until p is empty and returns the victims in order.
+func drain(p policy) []string {
+	var out []string
+	for {
+		k, ok := p.evict()
+		if !ok {
+			return out
+		}
+		out = append(out, k)
+	}
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	p := newLRU()
+	for _, k := range []string{"a", "b", "c"} {
+		p.add(k)
+	}
+	p.access("a")
+	p.add("b") // re-adding counts as a use
+	p.access("missing")
+	p.remove("c")
+	if got, want := drain(p), []string{"a", "b"}; !slices.Equal(got, want) {
+		t.Fatalf("evicted %v, want %v", got, want)
+	}
+}
+
+func TestLFUEvictsLeastFrequentlyUsed(t *testing.T) {
+	p := newLFU()
+	for _, k := range []string{"a", "b", "c", "d"} {
+		p.add(k)
+	}
+	p.access("a")
+	p.access("a")
+	p.access("b")
+	p.access("d")
+	// c was used once; b and d twice, with b the older of the tie; a three times
+	if got, want := drain(p), []string{"c", "b", "d", "a"}; !slices.Equal(got, want) {
+		t.Fatalf("evicted %v, want %v", got, want)
+	}
+
+	// a fresh key starts at the lowest frequency again
+	p.add("x")
+	p.access("x")
+	p.add("y")
+	if k, _ := p.evict(); k != "y" {
+		t.Fatalf("evicted %q, want y", k)
+	}
+}
+
+func TestTwoQueueResistsScans(t *testing.T) {
+	p := newTwoQueue()
+	p.add("hot")
+	for i := range 3 {
+		p.add(fmt.Sprintf("scan-%d", i))
+	}
+	// hot leaves A1in first but is remembered in A1out
+	if k, _ := p.evict(); k != "hot" {
+		t.Fatalf("evicted %q, want hot", k)
+	}
+	p.add("hot") // seen again: promoted to Am
+	for i := 3; i < 10; i++ {
+		p.add(fmt.Sprintf("scan-%d", i))
+		if k, _ := p.evict(); k == "hot" {
+			t.Fatalf("hot key evicted by a scan after %d keys", i)
+		}
+	}
+	// accessing keys only in A1in does not reorder them
+	p.access("scan-9")
+	got := drain(p)
+	if got[len(got)-1] != "hot" {
+		t.Fatalf("evicted %v, want hot last", got)
+	}
+	for _, k := range got[:len(got)-1] {
+		if !strings.HasPrefix(k, "scan-") {
+			t.Fatalf("evicted %v", got)
+		}
+	}
+}
+
+func TestStoreMaxEntries(t *testing.T) {
+	for _, name := range []string{PolicyLRU, PolicyLFU, Policy2Q} {
+		s, err := New(Options{MaxEntries: 3, Policy: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range 10 {
+			s.Set(models.Order{OrderUID: fmt.Sprintf("order-%d", i)})
+		}
+		st := s.Stats()
+		if st.Entries != 3 || st.Evictions != 7 || st.Sets != 10 {
+			t.Fatalf("%s: stats %+v, want 3 entries after 7 evictions", name, st)
+		}
+	}
+}
+
+func TestStoreMaxBytes(t *testing.T) {
+	o := models.Order{OrderUID: "order-0", Items: make([]models.Item, 2)}
+	size := approxSize(o)
+	s, err := New(Options{MaxBytes: 3*size + size/2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		o.OrderUID = fmt.Sprintf("order-%d", i)
+		s.Set(o)
+		if st := s.Stats(); st.Bytes > 3*size+size/2 {
+			t.Fatalf("holds %d bytes over a %d budget", st.Bytes, 3*size+size/2)
+		}
+	}
+	if s.Len() != 3 {
+		t.Fatalf("holds %d orders, want 3", s.Len())
+	}
+	// the oldest went first
+	if _, ok := s.Get("order-1"); ok {
+		t.Fatal("order-1 survived")
+	}
+
+	s.Delete("order-4")
+	if st := s.Stats(); st.Bytes != 2*size {
+		t.Fatalf("holds %d bytes after delete, want %d", st.Bytes, 2*size)
+	}
+}
+
+func TestApproxSizeGrows(t *testing.T) {
+	small := models.Order{OrderUID: "a"}
+	big := models.Order{OrderUID: "a", Items: []models.Item{{Name: strings.Repeat("x", 100)}}}
+	if approxSize(big) <= approxSize(small)+100 {
+		t.Fatalf("approxSize %d for an item of 100 bytes over %d", approxSize(big), approxSize(small))
+	}
+}
+
+func TestClearResetsPolicy(t *testing.T) {
+	for _, name := range []string{PolicyLRU, PolicyLFU, Policy2Q} {
+		s, err := New(Options{MaxEntries: 2, Policy: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Set(models.Order{OrderUID: "a"})
+		s.Set(models.Order{OrderUID: "b"})
+		s.Clear()
+		if k, ok := s.policy.evict(); ok {
+			t.Fatalf("%s: policy still tracks %q after Clear", name, k)
+		}
+		if st := s.Stats(); st.Entries != 0 || st.Bytes != 0 {
+			t.Fatalf("%s: stats %+v after Clear", name, st)
+		}
+		s.Set(models.Order{OrderUID: "c"})
+		s.Set(models.Order{OrderUID: "d"})
+		if s.Len() != 2 {
+			t.Fatalf("%s: %d entries, want 2", name, s.Len())
+		}
+	}
+}
+
+func TestUnknownPolicy(t *testing.T) {
+	if _, err := New(Options{MaxEntries: 1, Policy: "mru"}); err == nil {
+		t.Fatal("accepted an unknown policy")
+	}
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+const defaultShards = 16
+
+// Sharded spreads orders over independent stores keyed by a hash of order_uid,
+// so readers and writers of different orders do not contend on one lock.
+// Limits and eviction are applied per shard: the budget is split so the shards
+// add up to exactly MaxEntries and MaxBytes, and a full shard evicts even while
+// others still have room.
+type Sharded struct {
+	seed   maphash.Seed
+	mask   uint64
+	shards []*Store
+	warmUp warmUpInfo
+}
+
+func NewSharded(opts Options) (*Sharded, error) {
+	n := defaultShards
+	if opts.Shards > 0 {
+		// a power of two lets shard selection use a mask instead of a division
+		n = 1 << bits.Len(uint(opts.Shards-1))
+	}
+	// every shard needs a non-zero budget, since zero means unbounded
+	for n > 1 && opts.MaxEntries > 0 && opts.MaxEntries < n {
+		n >>= 1
+	}
+	s := &Sharded{
+		seed:   maphash.MakeSeed(),
+		mask:   uint64(n - 1),
+		shards: make([]*Store, n),
+	}
+	for i := range s.shards {
+		per := opts
+		if opts.MaxEntries > 0 {
+			per.MaxEntries = opts.MaxEntries / n
+			if i < opts.MaxEntries%n {
+				per.MaxEntries++
+			}
+		}
+		if opts.MaxBytes > 0 {
+			per.MaxBytes = opts.MaxBytes / int64(n)
+			if int64(i) < opts.MaxBytes%int64(n) {
+				per.MaxBytes++
+			}
+		}
+		st, err := New(per)
+		if err != nil {
+			return nil, err
+		}
+		s.shards[i] = st
+	}
+	return s, nil
+}
+
+// shard uses a per-process random seed so crafted ids cannot pile onto a single shard.
+func (s *Sharded) shard(id string) *Store {
+	return s.shards[maphash.String(s.seed, id)&s.mask]
+}
+
+func (s *Sharded) Get(id string) (models.Order, bool) { return s.shard(id).Get(id) }
+
+func (s *Sharded) Set(o models.Order) { s.shard(o.OrderUID).Set(o) }
+
+func (s *Sharded) SetWithTTL(o models.Order, ttl time.Duration) {
+	s.shard(o.OrderUID).SetWithTTL(o, ttl)
+}
+
+func (s *Sharded) Delete(id string) { s.shard(id).Delete(id) }
+
+func (s *Sharded) Len() int {
+	n := 0
+	for _, sh := range s.shards {
+		n += sh.Len()
+	}
+	return n
+}
+
+func (s *Sharded) Range(fn func(models.Order) bool) {
+	stopped := false
+	for _, sh := range s.shards {
+		sh.Range(func(o models.Order) bool {
+			stopped = !fn(o)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// Secondary keys are not tied to the order_uid hash, so lookups ask every shard.
+
+func (s *Sharded) GetByTrackNumber(track string) (models.Order, bool) {
+	orders := s.gather(func(sh *Store) []models.Order {
+		if o, ok := sh.GetByTrackNumber(track); ok {
+			return []models.Order{o}
+		}
+		return nil
+	})
+	if len(orders) == 0 {
+		return models.Order{}, false
+	}
+	return orders[0], true
+}
+
+func (s *Sharded) ByCustomer(customerID string) []models.Order {
+	return s.gather(func(sh *Store) []models.Order { return sh.ByCustomer(customerID) })
+}
+
+func (s *Sharded) ByNmID(nmID int) []models.Order {
+	return s.gather(func(sh *Store) []models.Order { return sh.ByNmID(nmID) })
+}
+
+func (s *Sharded) ByChrtID(chrtID int) []models.Order {
+	return s.gather(func(sh *Store) []models.Order { return sh.ByChrtID(chrtID) })
+}
+
+func (s *Sharded) gather(fn func(*Store) []models.Order) []models.Order {
+	var out []models.Order
+	for _, sh := range s.shards {
+		out = append(out, fn(sh)...)
+	}
+	sortOrders(out)
+	return out
+}
+
+func (s *Sharded) Stats() Stats {
+	var st Stats
+	for _, sh := range s.shards {
+		st = st.add(sh.Stats())
+	}
+	s.warmUp.fill(&st)
+	return st
+}
+
+func (s *Sharded) Clear() {
+	for _, sh := range s.shards {
+		sh.Clear()
+	}
+}
+
+func (s *Sharded) recordWarmUp(orders int, d time.Duration) { s.warmUp.record(orders, d) }
+
+func (s *Sharded) addMissing(orders []models.Order) {
+	buckets := make(map[*Store][]models.Order, len(s.shards))
+	for _, o := range orders {
+		sh := s.shard(o.OrderUID)
+		buckets[sh] = append(buckets[sh], o)
+	}
+	for sh, part := range buckets {
+		sh.addMissing(part)
+	}
+}
+
+func (s *Sharded) sweep(now time.Time) int {
+	n := 0
+	for _, sh := range s.shards {
+		n += sh.sweep(now)
+	}
+	return n
+}
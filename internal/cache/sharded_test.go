@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+func TestShardedNeverExceedsMaxEntries(t *testing.T) {
+	for _, tt := range []struct{ shards, max int }{{5, 10}, {16, 10}, {16, 100}, {3, 1}, {0, 7}} {
+		s, err := NewSharded(Options{Shards: tt.shards, MaxEntries: tt.max})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range 10 * tt.max {
+			s.Set(models.Order{OrderUID: fmt.Sprintf("order-%d", i)})
+			if n := s.Len(); n > tt.max {
+				t.Fatalf("shards %d, max %d: holds %d entries", tt.shards, tt.max, n)
+			}
+		}
+	}
+}
+
+// BenchmarkParallel compares the single-lock Store with Sharded under
+// concurrent load at several read/write mixes.
+func BenchmarkParallel(b *testing.B) {
+	const keys = 10_000
+	orders := make([]models.Order, keys)
+	for i := range orders {
+		orders[i] = models.Order{OrderUID: fmt.Sprintf("order-%06d", i), TrackNumber: fmt.Sprintf("T%d", i)}
+	}
+	backends := []struct {
+		name string
+		open func() (OrderCache, error)
+	}{
+		{"map", func() (OrderCache, error) { return New(Options{}) }},
+		{"sharded", func() (OrderCache, error) { return NewSharded(Options{}) }},
+		{"map-lru", func() (OrderCache, error) { return New(Options{MaxEntries: keys / 2}) }},
+		{"sharded-lru", func() (OrderCache, error) { return NewSharded(Options{MaxEntries: keys / 2}) }},
+	}
+	for _, reads := range []int{90, 50, 10} {
+		for _, be := range backends {
+			b.Run(fmt.Sprintf("%s/reads=%d%%", be.name, reads), func(b *testing.B) {
+				c, err := be.open()
+				if err != nil {
+					b.Fatal(err)
+				}
+				for _, o := range orders {
+					c.Set(o)
+				}
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					r := rand.New(rand.NewPCG(rand.Uint64(), 0))
+					for pb.Next() {
+						o := orders[r.IntN(keys)]
+						if r.IntN(100) < reads {
+							c.Get(o.OrderUID)
+						} else {
+							c.Set(o)
+						}
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"unsafe"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+const (
+	// mapEntryOverhead roughly covers the map bucket slot, the key header and policy bookkeeping.
+	mapEntryOverhead = 128
+	// indexEntryOverhead is the cost of one secondary index link to the order.
+	indexEntryOverhead = 64
+)
+
+func approxSize(o models.Order) int64 {
+	n := int64(unsafe.Sizeof(o)) + mapEntryOverhead + int64(2+2*len(o.Items))*indexEntryOverhead
+	n += int64(len(o.OrderUID)*2 + len(o.TrackNumber) + len(o.Entry) + len(o.Locale) +
+		len(o.InternalSignature) + len(o.CustomerID) + len(o.DeliveryService) + len(o.Shardkey) +
+		len(o.OofShard))
+
+	d := o.Delivery
+	n += int64(len(d.Name) + len(d.Phone) + len(d.Zip) + len(d.City) + len(d.Address) +
+		len(d.Region) + len(d.Email))
+
+	p := o.Payment
+	n += int64(len(p.Transaction) + len(p.RequestID) + len(p.Currency) + len(p.Provider) + len(p.Bank))
+
+	n += int64(cap(o.Items)) * int64(unsafe.Sizeof(models.Item{}))
+	for _, it := range o.Items {
+		n += int64(len(it.TrackNumber) + len(it.RID) + len(it.Name) + len(it.Size) + len(it.Brand))
+	}
+
+	n += int64(cap(o.Flags)) * int64(unsafe.Sizeof(models.Flag{}))
+	for _, f := range o.Flags {
+		n += int64(len(f.Field) + len(f.Message))
+	}
+	return n
+}
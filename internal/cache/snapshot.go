@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/repo"
+	"github.com/rs/zerolog/log"
+)
+
+// A snapshot is a gzip'd JSON lines file: a header line, one line per order and a
+// trailer with the order count and a SHA-256 over every line before it.
+
+const (
+	snapshotFormat  = "techwb-l0-cache"
+	snapshotVersion = 1
+	snapshotBatch   = 1000
+	// reconcileSkew covers clock drift between this host and Postgres now().
+	reconcileSkew = time.Minute
+)
+
+var ErrCorruptSnapshot = errors.New("corrupt cache snapshot")
+
+type snapshotHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type snapshotTrailer struct {
+	Count  int    `json:"count"`
+	SHA256 string `json:"sha256"`
+}
+
+type snapshotLine struct {
+	Order *models.Order    `json:"o,omitempty"`
+	End   *snapshotTrailer `json:"end,omitempty"`
+}
+
+// SaveSnapshot writes the cache contents to path atomically via a temporary file.
+func SaveSnapshot(c OrderCache, path string) (int, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	n, err := writeSnapshot(tmp, c, time.Now().UTC())
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp.Name(), path)
+}
+
+func writeSnapshot(w io.Writer, c OrderCache, createdAt time.Time) (int, error) {
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	sum := sha256.New()
+	out := io.MultiWriter(bw, sum)
+	enc := json.NewEncoder(out)
+
+	if err := enc.Encode(snapshotHeader{Format: snapshotFormat, Version: snapshotVersion, CreatedAt: createdAt}); err != nil {
+		return 0, err
+	}
+	// copy first so encoding and disk writes do not hold the cache locks
+	orders := make([]models.Order, 0, c.Len())
+	c.Range(func(o models.Order) bool {
+		orders = append(orders, o)
+		return true
+	})
+	for i := range orders {
+		if err := enc.Encode(snapshotLine{Order: &orders[i]}); err != nil {
+			return 0, err
+		}
+	}
+	trailer := snapshotLine{End: &snapshotTrailer{Count: len(orders), SHA256: hex.EncodeToString(sum.Sum(nil))}}
+	if err := json.NewEncoder(bw).Encode(trailer); err != nil {
+		return 0, err
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	return len(orders), zw.Close()
+}
+
+// readSnapshot verifies the snapshot and passes its orders to fn in batches.
+// With a nil fn it only checks integrity.
+func readSnapshot(path string, fn func([]models.Order)) (snapshotHeader, int, error) {
+	var hdr snapshotHeader
+	f, err := os.Open(path)
+	if err != nil {
+		return hdr, 0, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return hdr, 0, fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+	defer zr.Close()
+
+	br := bufio.NewReader(zr)
+	sum := sha256.New()
+	line, err := readLine(br, sum)
+	if err != nil {
+		return hdr, 0, fmt.Errorf("%w: header: %v", ErrCorruptSnapshot, err)
+	}
+	if err := json.Unmarshal(line, &hdr); err != nil || hdr.Format != snapshotFormat {
+		return hdr, 0, fmt.Errorf("%w: bad header", ErrCorruptSnapshot)
+	}
+	if hdr.Version != snapshotVersion {
+		return hdr, 0, fmt.Errorf("%w: unsupported version %d", ErrCorruptSnapshot, hdr.Version)
+	}
+
+	n := 0
+	batch := make([]models.Order, 0, snapshotBatch)
+	for {
+		digest := hex.EncodeToString(sum.Sum(nil))
+		line, err := readLine(br, sum)
+		if err != nil {
+			return hdr, n, fmt.Errorf("%w: truncated after %d orders: %v", ErrCorruptSnapshot, n, err)
+		}
+		var l snapshotLine
+		if err := json.Unmarshal(line, &l); err != nil {
+			return hdr, n, fmt.Errorf("%w: line %d: %v", ErrCorruptSnapshot, n+2, err)
+		}
+		if l.End != nil {
+			if l.End.Count != n || l.End.SHA256 != digest {
+				return hdr, n, fmt.Errorf("%w: checksum mismatch", ErrCorruptSnapshot)
+			}
+			break
+		}
+		if l.Order == nil || l.Order.OrderUID == "" {
+			return hdr, n, fmt.Errorf("%w: line %d: empty order", ErrCorruptSnapshot, n+2)
+		}
+		n++
+		if fn != nil {
+			batch = append(batch, *l.Order)
+			if len(batch) == snapshotBatch {
+				fn(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+	if fn != nil && len(batch) > 0 {
+		fn(batch)
+	}
+	return hdr, n, nil
+}
+
+func readLine(br *bufio.Reader, sum hash.Hash) ([]byte, error) {
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	sum.Write(line)
+	return bytes.TrimSpace(line), nil
+}
+
+// LoadSnapshot fills c from the snapshot at path and returns when it was taken.
+// The file is verified in full before anything is put into the cache.
+func LoadSnapshot(c OrderCache, path string) (time.Time, int, error) {
+	if _, _, err := readSnapshot(path, nil); err != nil {
+		return time.Time{}, 0, err
+	}
+	hdr, n, err := readSnapshot(path, func(orders []models.Order) { fill(c, orders) })
+	return hdr.CreatedAt, n, err
+}
+
+// Restore loads the snapshot and then pulls orders changed in the DB since it was
+// written. A missing or corrupt snapshot falls back to a full WarmUp.
+func Restore(ctx context.Context, c OrderCache, r *repo.PG, path string, pageSize int) error {
+	started := time.Now()
+	createdAt, n, err := LoadSnapshot(c, path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Info().Str("path", path).Msg("No cache snapshot, warming up from DB")
+		} else {
+			log.Warn().Err(err).Str("path", path).Msg("Unusable cache snapshot, warming up from DB")
+		}
+		return WarmUp(ctx, c, r, pageSize)
+	}
+	log.Info().Int("count", n).Time("created_at", createdAt).Dur("elapsed", time.Since(started)).
+		Msg("Loaded cache snapshot")
+
+	changed := 0
+	err = r.EachChangedOrdersPage(ctx, createdAt.Add(-reconcileSkew), pageSize, func(orders []models.Order) error {
+		// the DB is newer than the snapshot, so these overwrite
+		for _, o := range orders {
+			c.Set(o)
+		}
+		changed += len(orders)
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to reconcile cache snapshot with DB")
+		return err
+	}
+	recordWarmUp(c, n+changed, time.Since(started))
+	log.Info().Int("changed", changed).Dur("elapsed", time.Since(started)).Msg("Reconciled cache snapshot with DB")
+	return nil
+}
+
+// RunSnapshots saves a snapshot every interval until ctx is cancelled. It must only
+// be started once the cache is fully loaded, or a partial snapshot would be kept.
+func RunSnapshots(ctx context.Context, c OrderCache, path string, interval time.Duration) {
+	if path == "" || interval <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			started := time.Now()
+			n, err := SaveSnapshot(c, path)
+			if err != nil {
+				log.Error().Err(err).Str("path", path).Msg("Failed to save cache snapshot")
+				continue
+			}
+			log.Info().Int("count", n).Dur("elapsed", time.Since(started)).Msg("Saved cache snapshot")
+		}
+	}
+}
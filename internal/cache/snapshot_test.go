@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	src, err := NewSharded(Options{Shards: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2*snapshotBatch + 3 {
+		src.Set(models.Order{OrderUID: fmt.Sprintf("order-%d", i), TrackNumber: fmt.Sprintf("T%d", i)})
+	}
+	path := filepath.Join(t.TempDir(), "cache.snap")
+	n, err := SaveSnapshot(src, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != src.Len() {
+		t.Fatalf("saved %d orders, cache holds %d", n, src.Len())
+	}
+
+	dst, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, n, err = LoadSnapshot(dst, path); err != nil {
+		t.Fatal(err)
+	}
+	if n != src.Len() || dst.Len() != src.Len() {
+		t.Fatalf("loaded %d orders into %d entries, want %d", n, dst.Len(), src.Len())
+	}
+	if o, ok := dst.GetByTrackNumber("T42"); !ok || o.OrderUID != "order-42" {
+		t.Fatalf("GetByTrackNumber after load: %+v, %v", o, ok)
+	}
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type Stats struct {
+	Entries int `json:"entries"`
+	// Bytes is an estimate of the memory held by the entries and their indexes.
+	Bytes     int64  `json:"approx_bytes"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Sets      uint64 `json:"sets"`
+	Evictions uint64 `json:"evictions"`
+	Expired   uint64 `json:"expired"`
+
+	WarmUpOrders  int     `json:"warmup_orders"`
+	WarmUpSeconds float64 `json:"warmup_seconds"`
+}
+
+func (s Stats) add(o Stats) Stats {
+	s.Entries += o.Entries
+	s.Bytes += o.Bytes
+	s.Hits += o.Hits
+	s.Misses += o.Misses
+	s.Sets += o.Sets
+	s.Evictions += o.Evictions
+	s.Expired += o.Expired
+	return s
+}
+
+type counters struct {
+	hits, misses, sets atomic.Uint64
+	evictions, expired atomic.Uint64
+}
+
+func (c *counters) fill(st *Stats) {
+	st.Hits = c.hits.Load()
+	st.Misses = c.misses.Load()
+	st.Sets = c.sets.Load()
+	st.Evictions = c.evictions.Load()
+	st.Expired = c.expired.Load()
+}
+
+type warmUpInfo struct {
+	orders atomic.Int64
+	nanos  atomic.Int64
+}
+
+func (w *warmUpInfo) record(orders int, d time.Duration) {
+	w.orders.Store(int64(orders))
+	w.nanos.Store(int64(d))
+}
+
+func (w *warmUpInfo) fill(st *Stats) {
+	st.WarmUpOrders = int(w.orders.Load())
+	st.WarmUpSeconds = time.Duration(w.nanos.Load()).Seconds()
+}
+
+// warmUpRecorder is implemented by backends that report how the last warm-up went.
+type warmUpRecorder interface {
+	recordWarmUp(orders int, d time.Duration)
+}
+
+func recordWarmUp(c OrderCache, orders int, d time.Duration) {
+	if r, ok := c.(warmUpRecorder); ok {
+		r.recordWarmUp(orders, d)
+	}
+}
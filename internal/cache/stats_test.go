@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+func TestStatsCounters(t *testing.T) {
+	for name, open := range map[string]func() (OrderCache, error){
+		"map":     func() (OrderCache, error) { return New(Options{MaxEntries: 4}) },
+		"sharded": func() (OrderCache, error) { return NewSharded(Options{Shards: 2, MaxEntries: 4}) },
+	} {
+		c, err := open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range 6 {
+			c.Set(models.Order{OrderUID: fmt.Sprintf("order-%d", i)})
+		}
+		hits := 0
+		for i := range 6 {
+			if _, ok := c.Get(fmt.Sprintf("order-%d", i)); ok {
+				hits++
+			}
+		}
+		recordWarmUp(c, 6, 2*time.Second)
+
+		st := c.Stats()
+		want := Stats{Entries: c.Len(), Hits: uint64(hits), Misses: uint64(6 - hits), Sets: 6,
+			Evictions: uint64(6 - c.Len()), WarmUpOrders: 6, WarmUpSeconds: 2}
+		st.Bytes = 0
+		if st != want {
+			t.Fatalf("%s: stats %+v, want %+v", name, st, want)
+		}
+		if c.Len() > 4 || hits != c.Len() {
+			t.Fatalf("%s: %d entries, %d hits", name, c.Len(), hits)
+		}
+	}
+}
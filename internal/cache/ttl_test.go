@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/repo"
+)
+
+// eventually polls cond until it holds or a second has passed.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTTLExpiry(t *testing.T) {
+	s, err := New(Options{TTL: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set(models.Order{OrderUID: "a", TrackNumber: "T"})
+	s.SetWithTTL(models.Order{OrderUID: "forever"}, 0)
+	if _, ok := s.Get("a"); !ok {
+		t.Fatal("fresh entry missing")
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	if _, ok := s.GetByTrackNumber("T"); ok {
+		t.Fatal("expired entry found by track number")
+	}
+	if _, ok := s.Get("a"); ok {
+		t.Fatal("expired entry served without a refresh func")
+	}
+	if _, ok := s.Get("forever"); !ok {
+		t.Fatal("entry with a zero ttl expired")
+	}
+	if st := s.Stats(); st.Expired != 1 || st.Entries != 1 {
+		t.Fatalf("stats %+v, want one expired and one left", st)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	s, err := New(Options{TTL: 10 * time.Millisecond, StaleTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set(models.Order{OrderUID: "a"})
+	now := time.Now()
+	if n := s.sweep(now.Add(time.Minute)); n != 0 {
+		t.Fatalf("swept %d entries still within the stale window", n)
+	}
+	if n := s.sweep(now.Add(2 * time.Hour)); n != 1 {
+		t.Fatalf("swept %d entries, want 1", n)
+	}
+	if s.Len() != 0 || s.Stats().Expired != 1 {
+		t.Fatalf("stats %+v after sweep", s.Stats())
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	s, err := New(Options{
+		TTL:      10 * time.Millisecond,
+		StaleTTL: time.Minute,
+		Refresh: func(_ context.Context, id string) (models.Order, error) {
+			calls.Add(1)
+			<-release
+			return models.Order{OrderUID: id, TrackNumber: "fresh"}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set(models.Order{OrderUID: "a", TrackNumber: "stale"})
+	time.Sleep(20 * time.Millisecond)
+
+	// every read during the refresh gets the stale copy, and only one refresh runs
+	for range 5 {
+		o, ok := s.Get("a")
+		if !ok || o.TrackNumber != "stale" {
+			t.Fatalf("got %+v, %v, want the stale entry", o, ok)
+		}
+	}
+	eventually(t, "refresh to start", func() bool { return calls.Load() == 1 })
+	close(release)
+	eventually(t, "refreshed entry", func() bool {
+		o, _ := s.Get("a")
+		return o.TrackNumber == "fresh"
+	})
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("refreshed %d times, want 1", n)
+	}
+}
+
+func TestRefreshNotFoundDeletes(t *testing.T) {
+	s, err := New(Options{
+		TTL:      10 * time.Millisecond,
+		StaleTTL: time.Minute,
+		Refresh: func(context.Context, string) (models.Order, error) {
+			return models.Order{}, repo.ErrNotFound
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set(models.Order{OrderUID: "a"})
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := s.Get("a"); !ok {
+		t.Fatal("stale entry not served")
+	}
+	eventually(t, "deleted entry", func() bool { return s.Len() == 0 })
+}
+
+func TestStaleWindowPassed(t *testing.T) {
+	var calls atomic.Int32
+	s, err := New(Options{
+		TTL:      10 * time.Millisecond,
+		StaleTTL: 10 * time.Millisecond,
+		Refresh: func(_ context.Context, id string) (models.Order, error) {
+			calls.Add(1)
+			return models.Order{OrderUID: id}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set(models.Order{OrderUID: "a"})
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := s.Get("a"); ok {
+		t.Fatal("served an entry past its stale window")
+	}
+	if calls.Load() != 0 {
+		t.Fatal("refreshed an entry past its stale window")
+	}
+}
+
+func TestRefreshKeepsNewerSet(t *testing.T) {
+	release := make(chan struct{})
+	done := make(chan struct{})
+	s, err := New(Options{
+		TTL:      10 * time.Millisecond,
+		StaleTTL: time.Minute,
+		Refresh: func(_ context.Context, id string) (models.Order, error) {
+			defer close(done)
+			<-release
+			return models.Order{OrderUID: id, TrackNumber: "refreshed"}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set(models.Order{OrderUID: "a", TrackNumber: "stale"})
+	time.Sleep(20 * time.Millisecond)
+	s.Get("a")
+	s.SetWithTTL(models.Order{OrderUID: "a", TrackNumber: "consumer"}, 0)
+	close(release)
+	<-done
+	eventually(t, "refresh to finish", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.refreshing) == 0
+	})
+	if o, _ := s.Get("a"); o.TrackNumber != "consumer" {
+		t.Fatalf("cache holds %q, want the order set during the refresh", o.TrackNumber)
+	}
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/repo"
+	"github.com/rs/zerolog/log"
+)
+
+// missingAdder is implemented by backends that can fill a page of orders without
+// overwriting entries written concurrently by the consumer or HTTP handler.
+type missingAdder interface {
+	addMissing(orders []models.Order)
+}
+
+type sweeper interface {
+	sweep(now time.Time) int
+}
+
+func fill(c OrderCache, orders []models.Order) {
+	if ma, ok := c.(missingAdder); ok {
+		ma.addMissing(orders)
+		return
+	}
+	for _, o := range orders {
+		c.Set(o)
+	}
+}
+
+func WarmUp(ctx context.Context, c OrderCache, r *repo.PG, pageSize int) error {
+	started := time.Now()
+	total := 0
+	err := r.EachOrdersPage(ctx, pageSize, func(orders []models.Order) error {
+		fill(c, orders)
+		total += len(orders)
+		log.Info().Int("loaded", total).Dur("elapsed", time.Since(started)).Msg("Cache warm-up progress")
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Int("loaded", total).Msg("Failed to load orders from DB")
+		return err
+	}
+	recordWarmUp(c, total, time.Since(started))
+	log.Info().Int("count", total).Dur("elapsed", time.Since(started)).
+		Uint64("evictions", c.Stats().Evictions).Msg("Loaded orders to cache")
+	return nil
+}
+
+// RunJanitor periodically drops entries that are past their TTL and stale window.
+// It blocks until ctx is cancelled; a non-positive interval disables it.
+func RunJanitor(ctx context.Context, c OrderCache, interval time.Duration) {
+	sw, ok := c.(sweeper)
+	if !ok || interval <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			if n := sw.sweep(now); n > 0 {
+				log.Debug().Int("count", n).Msg("Swept expired orders from cache")
+			}
+		}
+	}
+}
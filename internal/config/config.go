@@ -4,25 +4,60 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
 	HTTPAddr     string
+	AdminToken   string
 	PGURL        string
 	KafkaBrokers []string
 	KafkaTopic   string
 	KafkaGroupID string
 	LogPretty    bool
 	LogLevel     string
+
+	KafkaDLQTopic         string
+	KafkaRetryMaxAttempts int
+	KafkaRetryBaseDelay   time.Duration
+	KafkaRetryMaxDelay    time.Duration
+	KafkaBadMessagePolicy string
+	KafkaBatchSize        int
+	KafkaBatchWait        time.Duration
+	KafkaWorkers          int
+	KafkaDispatch         string
+	KafkaDrainTimeout     time.Duration
+	KafkaExactlyOnce      bool
+
+	ReconcileMode     string
+	SchemaRegistryURL string
+
+	CacheBackend        string
+	CacheShards         int
+	CacheWarmUpPageSize int
+	CacheWarmUpAsync    bool
+	CacheMaxEntries     int
+	CacheMaxBytes       int64
+	CachePolicy         string
+	CacheTTL            time.Duration
+	CacheStaleTTL       time.Duration
+	CacheJanitorEvery   time.Duration
+	CacheNegativeMax    int
+	CacheNegativeTTL    time.Duration
+	CacheSnapshotPath   string
+	CacheSnapshotEvery  time.Duration
+	CacheInvalidation   bool
+	CacheLogSample      int
 }
 
 func Load() Config {
 	_ = godotenv.Load()
 
 	return Config{
-		HTTPAddr: getenv("HTTP_ADDR", ":8081"),
+		HTTPAddr:   getenv("HTTP_ADDR", ":8081"),
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
 		PGURL: firstNonEmpty(
 			os.Getenv("POSTGRES_DSN"),
 		),
@@ -31,6 +66,38 @@ func Load() Config {
 		KafkaGroupID: firstNonEmpty(os.Getenv("KAFKA_GROUP_ID"), os.Getenv("KAFKA_GROUP"), "orders-consumer"),
 		LogPretty:    getbool("LOG_PRETTY", true),
 		LogLevel:     getenv("LOG_LEVEL", "info"),
+
+		KafkaDLQTopic:         getenv("KAFKA_DLQ_TOPIC", "orders-dlq"),
+		KafkaRetryMaxAttempts: getint("KAFKA_RETRY_MAX_ATTEMPTS", 10),
+		KafkaRetryBaseDelay:   getduration("KAFKA_RETRY_BASE_DELAY", 200*time.Millisecond),
+		KafkaRetryMaxDelay:    getduration("KAFKA_RETRY_MAX_DELAY", 30*time.Second),
+		KafkaBadMessagePolicy: getenv("KAFKA_BAD_MESSAGE_POLICY", "dlq"),
+		KafkaBatchSize:        getint("KAFKA_BATCH_SIZE", 1),
+		KafkaBatchWait:        getduration("KAFKA_BATCH_WAIT", 100*time.Millisecond),
+		KafkaWorkers:          getint("KAFKA_WORKERS", 1),
+		KafkaDispatch:         getenv("KAFKA_DISPATCH", "partition"),
+		KafkaDrainTimeout:     getduration("KAFKA_DRAIN_TIMEOUT", 10*time.Second),
+		KafkaExactlyOnce:      getbool("KAFKA_EXACTLY_ONCE", true),
+
+		ReconcileMode:     getenv("RECONCILE_MODE", "flag"),
+		SchemaRegistryURL: os.Getenv("SCHEMA_REGISTRY_URL"),
+
+		CacheBackend:        getenv("CACHE_BACKEND", "sharded"),
+		CacheShards:         getint("CACHE_SHARDS", 16),
+		CacheWarmUpPageSize: getint("CACHE_WARMUP_PAGE_SIZE", 1000),
+		CacheWarmUpAsync:    getbool("CACHE_WARMUP_ASYNC", false),
+		CacheMaxEntries:     getint("CACHE_MAX_ENTRIES", 0),
+		CacheMaxBytes:       getint64("CACHE_MAX_BYTES", 0),
+		CachePolicy:         getenv("CACHE_POLICY", "lru"),
+		CacheTTL:            getduration("CACHE_TTL", 0),
+		CacheStaleTTL:       getduration("CACHE_STALE_TTL", 0),
+		CacheJanitorEvery:   getduration("CACHE_JANITOR_INTERVAL", time.Minute),
+		CacheNegativeMax:    getint("CACHE_NEGATIVE_MAX", 10000),
+		CacheNegativeTTL:    getduration("CACHE_NEGATIVE_TTL", 30*time.Second),
+		CacheSnapshotPath:   getenv("CACHE_SNAPSHOT_PATH", ""),
+		CacheSnapshotEvery:  getduration("CACHE_SNAPSHOT_INTERVAL", 5*time.Minute),
+		CacheInvalidation:   getbool("CACHE_INVALIDATION", true),
+		CacheLogSample:      getint("CACHE_LOG_SAMPLE", 100),
 	}
 }
 
@@ -51,6 +118,36 @@ func getbool(k string, def bool) bool {
 	return def
 }
 
+func getint(k string, def int) int {
+	if v := os.Getenv(k); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+func getint64(k string, def int64) int64 {
+	if v := os.Getenv(k); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+func getduration(k string, def time.Duration) time.Duration {
+	if v := os.Getenv(k); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			return d
+		}
+	}
+	return def
+}
+
 func split(s string) []string {
 	var out []string
 	for _, p := range strings.Split(s, ",") {
@@ -0,0 +1,116 @@
+package events
+
+import (
+	"context"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"mime"
+	"sync"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/schemaregistry"
+
+	"github.com/hamba/avro/v2"
+)
+
+const ContentTypeAvro = "application/avro"
+
+// avroMagic starts every message in the Confluent wire format, followed by the
+// big-endian schema id and the Avro binary body.
+const avroMagic = 0
+
+//go:embed order.avsc
+var orderSchema string
+
+// avroAPI reuses the json tags of internal/models, so the models need no avro tags.
+var avroAPI = avro.Config{TagKey: "json"}.Freeze()
+
+var ErrNotAvro = errors.New("not in the Confluent Avro wire format")
+
+// Avro encodes and decodes orders in the Confluent wire format. Messages are
+// decoded with the writer's schema fetched by id, so producers may add or drop
+// fields without breaking the consumer.
+type Avro struct {
+	registry *schemaregistry.Client
+	subject  string
+	schema   avro.Schema
+
+	mu      sync.RWMutex
+	writers map[int]avro.Schema
+}
+
+// NewAvro registers orders under subject when encoding; decoding needs no
+// subject. Confluent's default naming is "<topic>-value".
+func NewAvro(registry *schemaregistry.Client, subject string) *Avro {
+	return &Avro{
+		registry: registry,
+		subject:  subject,
+		schema:   avro.MustParse(orderSchema),
+		writers:  make(map[int]avro.Schema),
+	}
+}
+
+// IsAvro reports whether a message should be decoded as Avro: either it says
+// so in its content type or it has none and starts with the wire format magic
+// byte, which no JSON or Protobuf order does.
+func IsAvro(contentType string, value []byte) bool {
+	if contentType != "" {
+		mt, _, err := mime.ParseMediaType(contentType)
+		return err == nil && mt == ContentTypeAvro
+	}
+	return len(value) > 5 && value[0] == avroMagic
+}
+
+func (a *Avro) Encode(ctx context.Context, o models.Order) ([]byte, error) {
+	id, err := a.registry.Register(ctx, a.subject, a.schema.String())
+	if err != nil {
+		return nil, err
+	}
+	body, err := avroAPI.Marshal(a.schema, o)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 5, 5+len(body))
+	out[0] = avroMagic
+	binary.BigEndian.PutUint32(out[1:], uint32(id))
+	return append(out, body...), nil
+}
+
+// Decode returns schemaregistry.ErrUnavailable, wrapped, when the writer schema
+// could not be fetched; any other error means the message is unusable.
+func (a *Avro) Decode(ctx context.Context, value []byte) (models.Order, error) {
+	var o models.Order
+	if len(value) < 5 || value[0] != avroMagic {
+		return o, ErrNotAvro
+	}
+	id := int(binary.BigEndian.Uint32(value[1:5]))
+	schema, err := a.writer(ctx, id)
+	if err != nil {
+		return o, err
+	}
+	err = avroAPI.Unmarshal(schema, value[5:], &o)
+	return o, err
+}
+
+func (a *Avro) writer(ctx context.Context, id int) (avro.Schema, error) {
+	a.mu.RLock()
+	s, ok := a.writers[id]
+	a.mu.RUnlock()
+	if ok {
+		return s, nil
+	}
+	text, err := a.registry.Schema(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s, err = avro.Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("schema %d: %w", id, err)
+	}
+	a.mu.Lock()
+	a.writers[id] = s
+	a.mu.Unlock()
+	return s, nil
+}
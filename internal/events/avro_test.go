@@ -0,0 +1,142 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/schemaregistry/schemaregistrytest"
+
+	"github.com/hamba/avro/v2"
+)
+
+func testOrder() models.Order {
+	return models.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: models.Delivery{Name: "Test Testov", Phone: "+9720000000", Zip: "2639809",
+			City: "Kiryat Mozkin", Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com"},
+		Payment: models.Payment{Transaction: "b563feb7b2b84b6test", Currency: "USD", Provider: "wbpay",
+			Amount: 1817, PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317},
+		Items: []models.Item{{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, RID: "ab4219087a764ae0btest",
+			Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202}},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		Shardkey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		OofShard:        "1",
+	}
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	reg := schemaregistrytest.New()
+	a := NewAvro(reg.Client(), "orders-value")
+	ctx := context.Background()
+
+	want := testOrder()
+	b, err := a.Encode(ctx, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsAvro("", b) || !IsAvro("application/avro; charset=binary", b) {
+		t.Fatal("encoded order not recognised as Avro")
+	}
+	// a fresh codec has to fetch the writer schema from the registry
+	got, err := NewAvro(reg.Client(), "").Decode(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.DateCreated.Equal(want.DateCreated) {
+		t.Fatalf("date_created %v, want %v", got.DateCreated, want.DateCreated)
+	}
+	got.DateCreated = want.DateCreated
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decoded %+v\nwant %+v", got, want)
+	}
+}
+
+// TestAvroSchemaEvolution decodes a message from a producer whose schema has
+// an extra field and lacks one the consumer knows.
+func TestAvroSchemaEvolution(t *testing.T) {
+	reg := schemaregistrytest.New()
+	client := reg.Client()
+	ctx := context.Background()
+
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(orderSchema), &schema); err != nil {
+		t.Fatal(err)
+	}
+	var fields []any
+	for _, f := range schema["fields"].([]any) {
+		if f.(map[string]any)["name"] != "oof_shard" {
+			fields = append(fields, f)
+		}
+	}
+	schema["fields"] = append(fields, map[string]any{"name": "gift_note", "type": "string", "default": ""})
+	text, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := avro.MustParse(string(text))
+	id, err := client.Register(ctx, "orders-value", writer.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type orderV2 struct {
+		models.Order
+		GiftNote string `json:"gift_note"`
+	}
+	want := testOrder()
+	body, err := avroAPI.Marshal(writer, orderV2{Order: want, GiftNote: "happy birthday"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := append([]byte{avroMagic, 0, 0, 0, byte(id)}, body...)
+
+	got, err := NewAvro(client, "").Decode(ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.OofShard = ""
+	got.DateCreated = want.DateCreated
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decoded %+v\nwant %+v", got, want)
+	}
+}
+
+func TestAvroUnknownSchema(t *testing.T) {
+	a := NewAvro(schemaregistrytest.New().Client(), "")
+	if _, err := a.Decode(context.Background(), []byte{avroMagic, 0, 0, 0, 7, 2}); err == nil {
+		t.Fatal("decoded a message with an unregistered schema id")
+	}
+	if _, err := a.Decode(context.Background(), []byte(`{"order_uid":"x"}`)); !errors.Is(err, ErrNotAvro) {
+		t.Fatalf("JSON payload: %v, want ErrNotAvro", err)
+	}
+}
+
+func TestIsAvro(t *testing.T) {
+	for _, tt := range []struct {
+		contentType string
+		value       []byte
+		want        bool
+	}{
+		{"application/avro", []byte("x"), true},
+		{"application/avro; charset=binary", []byte("x"), true},
+		{"Application/Avro", []byte("x"), true},
+		{"application/json", []byte{0, 0, 0, 0, 1, 2}, false},
+		{"", []byte{0, 0, 0, 0, 1, 2}, true},
+		{"", []byte(`{"order_uid":"x"}`), false},
+	} {
+		if got := IsAvro(tt.contentType, tt.value); got != tt.want {
+			t.Errorf("IsAvro(%q, %q) = %v, want %v", tt.contentType, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+// CurrentVersion is the schema version producers should emit.
+const CurrentVersion = 1
+
+const (
+	OrderCreated = "order.created"
+	OrderUpdated = "order.updated"
+)
+
+var (
+	ErrInvalidEnvelope    = errors.New("invalid envelope")
+	ErrUnsupportedVersion = errors.New("unsupported schema version")
+	ErrUnknownEventType   = errors.New("unknown event type")
+	ErrUnknownField       = errors.New("unknown field")
+)
+
+// Envelope wraps an order event. Payload is decoded by the decoder registered
+// for SchemaVersion.
+type Envelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	EventType     string          `json:"event_type"`
+	Producer      string          `json:"producer"`
+	EmittedAt     time.Time       `json:"emitted_at"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// Decoder turns the payload of one schema version into the current model,
+// upcasting older versions as needed.
+type Decoder func(payload []byte) (models.Order, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[int]Decoder{
+		1: decodeV1,
+	}
+)
+
+// Register adds or replaces the decoder of a schema version. It is usually
+// called from init, but is safe to call while messages are being decoded.
+func Register(version int, d Decoder) {
+	decodersMu.Lock()
+	decoders[version] = d
+	decodersMu.Unlock()
+}
+
+// Decode accepts an Envelope or, for producers that predate it, a bare order.
+// Bare orders are decoded as version 1 and come back with a zero Envelope.
+// json errors are returned as is, so callers can tell malformed input apart.
+func Decode(value []byte) (Envelope, models.Order, error) {
+	var probe struct {
+		SchemaVersion *int            `json:"schema_version"`
+		Payload       json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(value, &probe); err != nil {
+		return Envelope{}, models.Order{}, err
+	}
+	if probe.SchemaVersion == nil && probe.Payload == nil {
+		var o models.Order
+		err := json.Unmarshal(value, &o)
+		return Envelope{}, o, err
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(value, &env); err != nil {
+		return env, models.Order{}, err
+	}
+	if probe.SchemaVersion == nil || len(env.Payload) == 0 {
+		return env, models.Order{}, fmt.Errorf("%w: schema_version and payload are required", ErrInvalidEnvelope)
+	}
+	switch env.EventType {
+	case OrderCreated, OrderUpdated:
+	default:
+		return env, models.Order{}, fmt.Errorf("%w %q", ErrUnknownEventType, env.EventType)
+	}
+	decodersMu.RLock()
+	d, ok := decoders[env.SchemaVersion]
+	decodersMu.RUnlock()
+	if !ok {
+		return env, models.Order{}, fmt.Errorf("%w %d", ErrUnsupportedVersion, env.SchemaVersion)
+	}
+	o, err := d(env.Payload)
+	return env, o, err
+}
+
+// Wrap builds a current-version envelope around o.
+func Wrap(eventType, producer string, o models.Order) ([]byte, error) {
+	payload, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{
+		SchemaVersion: CurrentVersion,
+		EventType:     eventType,
+		Producer:      producer,
+		EmittedAt:     time.Now().UTC(),
+		Payload:       payload,
+	})
+}
+
+// decodeV1 is strict about unknown fields: a producer that adds one has to bump
+// the schema version instead of having the field silently dropped. Such a
+// payload fails with ErrUnknownField.
+func decodeV1(payload []byte) (models.Order, error) {
+	var o models.Order
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&o)
+	// encoding/json has no error type for this, only the message
+	if err != nil && strings.HasPrefix(err.Error(), "json: unknown field ") {
+		return o, fmt.Errorf("%w %s", ErrUnknownField, strings.TrimPrefix(err.Error(), "json: unknown field "))
+	}
+	return o, err
+}
@@ -0,0 +1,118 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+func TestDecodeV1(t *testing.T) {
+	b, err := Wrap(OrderUpdated, "test", testOrder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, got, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.SchemaVersion != 1 || env.EventType != OrderUpdated || env.Producer != "test" || env.EmittedAt.IsZero() {
+		t.Fatalf("envelope %+v", env)
+	}
+	if !reflect.DeepEqual(got, testOrder()) {
+		t.Fatalf("decoded %+v, want %+v", got, testOrder())
+	}
+}
+
+func TestDecodeBareOrder(t *testing.T) {
+	b, err := json.Marshal(testOrder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, got, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(env, Envelope{}) || !reflect.DeepEqual(got, testOrder()) {
+		t.Fatalf("decoded %+v, %+v", env, got)
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		value string
+		want  error // nil for a plain json error
+	}{
+		{"future version", `{"schema_version":2,"event_type":"order.created","payload":{}}`, ErrUnsupportedVersion},
+		{"version 0", `{"schema_version":0,"event_type":"order.created","payload":{}}`, ErrUnsupportedVersion},
+		{"no version", `{"event_type":"order.created","payload":{}}`, ErrInvalidEnvelope},
+		{"no payload", `{"schema_version":1,"event_type":"order.created"}`, ErrInvalidEnvelope},
+		{"unknown event type", `{"schema_version":1,"event_type":"order.deleted","payload":{}}`, ErrUnknownEventType},
+		{"unknown field", `{"schema_version":1,"event_type":"order.created","payload":{"order_uid":"a","gift_wrap":true}}`, ErrUnknownField},
+		{"unknown nested field", `{"schema_version":1,"event_type":"order.created","payload":{"delivery":{"floor":3}}}`, ErrUnknownField},
+		{"wrong type", `{"schema_version":1,"event_type":"order.created","payload":{"order_uid":1}}`, nil},
+		{"malformed", `{"schema_version":1,`, nil},
+	} {
+		_, _, err := Decode([]byte(tt.value))
+		if err == nil {
+			t.Errorf("%s: decoded", tt.name)
+			continue
+		}
+		for _, sentinel := range []error{ErrUnsupportedVersion, ErrInvalidEnvelope, ErrUnknownEventType, ErrUnknownField} {
+			if errors.Is(err, sentinel) != (sentinel == tt.want) {
+				t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+			}
+		}
+	}
+}
+
+func TestDecodeUnknownFieldNamesIt(t *testing.T) {
+	_, _, err := Decode([]byte(`{"schema_version":1,"event_type":"order.created","payload":{"gift_wrap":true}}`))
+	if err == nil || err.Error() != `unknown field "gift_wrap"` {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestBareOrderIgnoresUnknownFields(t *testing.T) {
+	// producers without an envelope predate versioning, so they are not held to it
+	_, o, err := Decode([]byte(`{"order_uid":"a","gift_wrap":true}`))
+	if err != nil || o.OrderUID != "a" {
+		t.Fatalf("decoded %+v, %v", o, err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Cleanup(func() {
+		decodersMu.Lock()
+		delete(decoders, 99)
+		decodersMu.Unlock()
+	})
+	v99 := `{"schema_version":99,"event_type":"order.created","payload":{"id":"a"}}`
+
+	// registering while other goroutines decode is safe
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				Decode([]byte(v99))
+			}
+		}()
+	}
+	Register(99, func(payload []byte) (models.Order, error) {
+		var p struct{ ID string }
+		err := json.Unmarshal(payload, &p)
+		return models.Order{OrderUID: p.ID}, err
+	})
+	wg.Wait()
+
+	_, o, err := Decode([]byte(v99))
+	if err != nil || o.OrderUID != "a" {
+		t.Fatalf("decoded %+v, %v", o, err)
+	}
+}
@@ -0,0 +1,72 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/orderpb"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// HeaderContentType is the Kafka header naming the wire format of a message.
+const HeaderContentType = "content-type"
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+var ErrUnsupportedContentType = errors.New("unsupported content type")
+
+// DecodeAs decodes value in the given wire format. An empty content type means
+// JSON, which is what producers without the header send.
+func DecodeAs(contentType string, value []byte) (Envelope, models.Order, error) {
+	mt := contentType
+	if contentType != "" {
+		var err error
+		if mt, _, err = mime.ParseMediaType(contentType); err != nil {
+			return Envelope{}, models.Order{}, fmt.Errorf("%w %q", ErrUnsupportedContentType, contentType)
+		}
+	}
+	switch mt {
+	case "", ContentTypeJSON:
+		return Decode(value)
+	case ContentTypeProtobuf, "application/protobuf":
+		var x orderpb.Order
+		if err := proto.Unmarshal(value, &x); err != nil {
+			return Envelope{}, models.Order{}, err
+		}
+		return Envelope{}, orderpb.ToModel(&x), nil
+	}
+	return Envelope{}, models.Order{}, fmt.Errorf("%w %q", ErrUnsupportedContentType, contentType)
+}
+
+// IsJSON reports whether contentType is JSON, the default when it is empty.
+func IsJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mt == ContentTypeJSON
+}
+
+// Supported reports whether contentType names an order format the consumer reads.
+func Supported(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mt {
+	case ContentTypeJSON, ContentTypeProtobuf, "application/protobuf", ContentTypeAvro:
+		return true
+	}
+	return false
+}
+
+// EncodeProtobuf is the Protobuf counterpart of Wrap.
+func EncodeProtobuf(o models.Order) ([]byte, error) {
+	return proto.Marshal(orderpb.FromModel(o))
+}
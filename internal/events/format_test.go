@@ -0,0 +1,36 @@
+package events
+
+import "testing"
+
+func TestSupported(t *testing.T) {
+	for ct, want := range map[string]bool{
+		"application/json":                  true,
+		"application/json; charset=utf-8":   true,
+		"application/x-protobuf":            true,
+		"application/avro; charset=binary":  true,
+		"application/x-www-form-urlencoded": false,
+		"text/plain":                        false,
+		"":                                  false,
+		"not a media type;;":                false,
+	} {
+		if got := Supported(ct); got != want {
+			t.Errorf("Supported(%q) = %v, want %v", ct, got, want)
+		}
+	}
+}
+
+func TestIsJSON(t *testing.T) {
+	for ct, want := range map[string]bool{
+		"":                                true,
+		"application/json":                true,
+		"Application/JSON; charset=UTF-8": true,
+		"application/json-seq":            false,
+		"application/jsonx":               false,
+		"application/x-protobuf":          false,
+		"json":                            false,
+	} {
+		if got := IsJSON(ct); got != want {
+			t.Errorf("IsJSON(%q) = %v, want %v", ct, got, want)
+		}
+	}
+}
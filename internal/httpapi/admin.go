@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/ratmirtech/techwb-l0/internal/cache"
+
+	"github.com/rs/zerolog/log"
+)
+
+type cacheStats struct {
+	Cache  cache.Stats       `json:"cache"`
+	Loader cache.LoaderStats `json:"loader"`
+}
+
+func (a *API) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, cacheStats{Cache: a.cache.Stats(), Loader: a.loader.Stats()}, http.StatusOK)
+}
+
+func (a *API) handleEvictOrder(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	a.cache.Delete(id)
+	log.Info().Str("order_uid", id).Msg("admin: evicted order from cache")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) handleFlushCache(w http.ResponseWriter, r *http.Request) {
+	n := a.cache.Len()
+	a.cache.Clear()
+	log.Info().Int("orders", n).Msg("admin: flushed cache")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// private guards endpoints that expose customer data. Unlike admin it fails
+// closed: without a configured token they are not served at all.
+func (a *API) private(next http.HandlerFunc) http.HandlerFunc {
+	if a.adminToken == "" {
+		return http.NotFound
+	}
+	return a.admin(next)
+}
+
+// admin requires "Authorization: Bearer <ADMIN_TOKEN>" when a token is configured.
+func (a *API) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.adminToken != "" {
+			want := "Bearer " + a.adminToken
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,40 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultFlaggedLimit = 50
+	maxFlaggedLimit     = 500
+)
+
+// handleListFlagged pages through orders accepted with payment inconsistencies.
+// Pass the last order_uid of a page as after to get the next one.
+func (a *API) handleListFlagged(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := defaultFlaggedLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "bad limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxFlaggedLimit)
+	}
+	orders, err := a.repo.FlaggedOrdersPage(r.Context(), q.Get("after"), limit)
+	if err != nil {
+		log.Error().Err(err).Msg("list flagged orders")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if orders == nil {
+		orders = []models.Order{}
+	}
+	writeJSON(w, orders, http.StatusOK)
+}
@@ -1,12 +1,16 @@
 package httpapi
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/ratmirtech/techwb-l0/internal/cache"
+	"github.com/ratmirtech/techwb-l0/internal/models"
 	"github.com/ratmirtech/techwb-l0/internal/repo"
 
 	"github.com/rs/zerolog/log"
@@ -15,18 +19,39 @@ import (
 //go:embed static/index.html
 var indexHTML string
 
+// Store is the part of *repo.PG the admin endpoints read and write.
+type Store interface {
+	FlaggedOrdersPage(ctx context.Context, after string, limit int) ([]models.Order, error)
+	ListRejected(ctx context.Context, before int64, limit int) ([]models.RejectedMessage, error)
+	GetRejected(ctx context.Context, id int64) (models.RejectedMessage, error)
+	MarkResubmitted(ctx context.Context, id int64, cause error) error
+}
+
 type API struct {
-	cache *cache.Store
-	repo  *repo.PG
+	cache       cache.OrderCache
+	repo        Store
+	loader      *cache.Loader
+	resubmitter Resubmitter
+	adminToken  string
 }
 
-func New(c *cache.Store, r *repo.PG) *API { return &API{cache: c, repo: r} }
+func New(c cache.OrderCache, r Store, l *cache.Loader, rs Resubmitter, adminToken string) *API {
+	return &API{cache: c, repo: r, loader: l, resubmitter: rs, adminToken: adminToken}
+}
 
 func (a *API) Router() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", a.handleIndex)
 	mux.HandleFunc("/order/", a.handleGetOrder)
 	mux.HandleFunc("/api/order/", a.handleGetOrder)
+	mux.HandleFunc("/api/orders", a.handleFindOrders)
+	mux.HandleFunc("GET /api/cache/stats", a.handleCacheStats)
+	mux.HandleFunc("DELETE /api/cache/order/{id}", a.admin(a.handleEvictOrder))
+	mux.HandleFunc("POST /api/cache/flush", a.admin(a.handleFlushCache))
+	mux.HandleFunc("GET /api/orders/flagged", a.private(a.handleListFlagged))
+	mux.HandleFunc("GET /api/rejected", a.private(a.handleListRejected))
+	mux.HandleFunc("GET /api/rejected/{id}", a.private(a.handleGetRejected))
+	mux.HandleFunc("POST /api/rejected/{id}/resubmit", a.private(a.handleResubmitRejected))
 	return logMiddleware(mux)
 }
 
@@ -50,15 +75,55 @@ func (a *API) handleGetOrder(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, o, http.StatusOK)
 		return
 	}
-	o, err := a.repo.GetOrder(r.Context(), id)
-	if err != nil {
+	o, err := a.loader.Load(r.Context(), id)
+	if errors.Is(err, repo.ErrNotFound) {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
-	a.cache.Set(o)
+	if err != nil {
+		log.Error().Err(err).Str("order_uid", id).Msg("load order")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
 	writeJSON(w, o, http.StatusOK)
 }
 
+// handleFindOrders looks orders up by exactly one secondary key. Only cached
+// orders are searched.
+func (a *API) handleFindOrders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var orders []models.Order
+	switch {
+	case q.Get("track_number") != "":
+		if o, ok := a.cache.GetByTrackNumber(q.Get("track_number")); ok {
+			orders = append(orders, o)
+		}
+	case q.Get("customer_id") != "":
+		orders = a.cache.ByCustomer(q.Get("customer_id"))
+	case q.Get("nm_id") != "":
+		id, err := strconv.Atoi(q.Get("nm_id"))
+		if err != nil {
+			http.Error(w, "bad nm_id", http.StatusBadRequest)
+			return
+		}
+		orders = a.cache.ByNmID(id)
+	case q.Get("chrt_id") != "":
+		id, err := strconv.Atoi(q.Get("chrt_id"))
+		if err != nil {
+			http.Error(w, "bad chrt_id", http.StatusBadRequest)
+			return
+		}
+		orders = a.cache.ByChrtID(id)
+	default:
+		http.Error(w, "one of track_number, customer_id, nm_id, chrt_id required", http.StatusBadRequest)
+		return
+	}
+	if orders == nil {
+		orders = []models.Order{}
+	}
+	writeJSON(w, orders, http.StatusOK)
+}
+
 func writeJSON(w http.ResponseWriter, v any, code int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
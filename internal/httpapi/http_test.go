@@ -0,0 +1,213 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/cache"
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+// stubCache is an OrderCache backed by a plain map, enough for handler tests
+// that must not reach the database.
+type stubCache struct {
+	orders map[string]models.Order
+}
+
+func newStubCache(orders ...models.Order) *stubCache {
+	c := &stubCache{orders: make(map[string]models.Order)}
+	for _, o := range orders {
+		c.orders[o.OrderUID] = o
+	}
+	return c
+}
+
+func (c *stubCache) Get(id string) (models.Order, bool) {
+	o, ok := c.orders[id]
+	return o, ok
+}
+func (c *stubCache) Set(o models.Order)                         { c.orders[o.OrderUID] = o }
+func (c *stubCache) SetWithTTL(o models.Order, _ time.Duration) { c.Set(o) }
+func (c *stubCache) Delete(id string)                           { delete(c.orders, id) }
+func (c *stubCache) Len() int                                   { return len(c.orders) }
+func (c *stubCache) Stats() cache.Stats                         { return cache.Stats{Entries: len(c.orders)} }
+func (c *stubCache) Clear()                                     { clear(c.orders) }
+
+func (c *stubCache) Range(fn func(models.Order) bool) {
+	for _, o := range c.orders {
+		if !fn(o) {
+			return
+		}
+	}
+}
+
+func (c *stubCache) GetByTrackNumber(track string) (models.Order, bool) {
+	for _, o := range c.orders {
+		if o.TrackNumber == track {
+			return o, true
+		}
+	}
+	return models.Order{}, false
+}
+
+func (c *stubCache) ByCustomer(customerID string) []models.Order {
+	var out []models.Order
+	for _, o := range c.orders {
+		if o.CustomerID == customerID {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+func (c *stubCache) ByNmID(int) []models.Order   { return nil }
+func (c *stubCache) ByChrtID(int) []models.Order { return nil }
+
+func TestGetOrderFromCache(t *testing.T) {
+	c := newStubCache(models.Order{OrderUID: "b563feb7b2b84b6test", TrackNumber: "WBILMTESTTRACK"})
+	api := New(c, nil, nil, nil, "")
+
+	for _, path := range []string{"/order/b563feb7b2b84b6test", "/api/order/b563feb7b2b84b6test"} {
+		rec := httptest.NewRecorder()
+		api.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, body %s", path, rec.Code, rec.Body)
+		}
+		var got models.Order
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.TrackNumber != "WBILMTESTTRACK" {
+			t.Fatalf("%s: got order %+v", path, got)
+		}
+	}
+}
+
+func TestFindOrders(t *testing.T) {
+	c := newStubCache(
+		models.Order{OrderUID: "a", TrackNumber: "T1", CustomerID: "c1"},
+		models.Order{OrderUID: "b", TrackNumber: "T2", CustomerID: "c2"},
+	)
+	api := New(c, nil, nil, nil, "")
+
+	tests := []struct {
+		query string
+		code  int
+		uids  []string
+	}{
+		{"track_number=T2", http.StatusOK, []string{"b"}},
+		{"customer_id=c1", http.StatusOK, []string{"a"}},
+		{"customer_id=nobody", http.StatusOK, []string{}},
+		{"nm_id=x", http.StatusBadRequest, nil},
+		{"", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		api.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/orders?"+tt.query, nil))
+		if rec.Code != tt.code {
+			t.Fatalf("%q: status %d, want %d", tt.query, rec.Code, tt.code)
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var got []models.Order
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tt.uids) {
+			t.Fatalf("%q: got %d orders, want %v", tt.query, len(got), tt.uids)
+		}
+		for i, o := range got {
+			if o.OrderUID != tt.uids[i] {
+				t.Fatalf("%q: got %s, want %v", tt.query, o.OrderUID, tt.uids)
+			}
+		}
+	}
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	api := New(newStubCache(models.Order{OrderUID: "a"}), nil, nil, nil, "secret")
+
+	rec := httptest.NewRecorder()
+	api.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/cache/flush", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without token: status %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/cache/flush", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	api.Router().ServeHTTP(rec, req)
+	if rec.Code >= 300 {
+		t.Fatalf("with token: status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCacheStatsAndAdmin(t *testing.T) {
+	c, err := cache.New(cache.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set(models.Order{OrderUID: "a"})
+	c.Set(models.Order{OrderUID: "b"})
+	c.Get("a")
+	c.Get("missing")
+	l := cache.NewLoader(c, cache.NewNegative(0, 0), nil)
+	h := New(c, nil, l, nil, "secret").Router()
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/api/cache/stats", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("stats: status %d", rec.Code)
+	}
+	var st cacheStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Cache.Entries != 2 || st.Cache.Hits != 1 || st.Cache.Misses != 1 || st.Cache.Sets != 2 {
+		t.Fatalf("stats %+v", st.Cache)
+	}
+
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodDelete, "/api/cache/order/a"},
+		{http.MethodPost, "/api/cache/flush"},
+	} {
+		for _, token := range []string{"", "wrong"} {
+			if rec := do(tt.method, tt.path, token); rec.Code != http.StatusUnauthorized {
+				t.Fatalf("%s %s with token %q: status %d", tt.method, tt.path, token, rec.Code)
+			}
+		}
+	}
+	if c.Len() != 2 {
+		t.Fatal("unauthorized request changed the cache")
+	}
+
+	if rec := do(http.MethodDelete, "/api/cache/order/a", "secret"); rec.Code != http.StatusNoContent {
+		t.Fatalf("evict: status %d", rec.Code)
+	}
+	if _, ok := c.Get("a"); ok || c.Len() != 1 {
+		t.Fatal("evicted order still cached")
+	}
+	if rec := do(http.MethodPost, "/api/cache/flush", "secret"); rec.Code != http.StatusNoContent {
+		t.Fatalf("flush: status %d", rec.Code)
+	}
+	if c.Len() != 0 {
+		t.Fatalf("%d orders left after flush", c.Len())
+	}
+	// flushing keeps the counters
+	if st := c.Stats(); st.Sets != 2 {
+		t.Fatalf("stats %+v after flush", st)
+	}
+}
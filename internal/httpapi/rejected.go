@@ -0,0 +1,134 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/ratmirtech/techwb-l0/internal/events"
+	"github.com/ratmirtech/techwb-l0/internal/kafka"
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/repo"
+	"github.com/ratmirtech/techwb-l0/internal/validation"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultRejectedLimit = 50
+	maxRejectedLimit     = 500
+	maxPayloadBytes      = 1 << 20
+)
+
+// Resubmitter processes a quarantined payload as if it had just been consumed.
+// A payload that can never be stored is reported as a *kafka.RejectError.
+type Resubmitter interface {
+	Resubmit(ctx context.Context, contentType string, payload []byte) (models.Order, error)
+}
+
+type resubmitResult struct {
+	Order      *models.Order     `json:"order,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Violations validation.Errors `json:"violations,omitempty"`
+}
+
+func (a *API) handleListRejected(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := defaultRejectedLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "bad limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxRejectedLimit)
+	}
+	var before int64
+	if v := q.Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "bad before", http.StatusBadRequest)
+			return
+		}
+		before = n
+	}
+	msgs, err := a.repo.ListRejected(r.Context(), before, limit)
+	if err != nil {
+		log.Error().Err(err).Msg("list rejected messages")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, msgs, http.StatusOK)
+}
+
+func (a *API) handleGetRejected(w http.ResponseWriter, r *http.Request) {
+	m, ok := a.rejected(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, m, http.StatusOK)
+}
+
+// handleResubmitRejected reprocesses the stored payload, or the request body
+// when one is sent, e.g. after fixing the message by hand. A body is decoded
+// according to the request's Content-Type, or as JSON when that names no order
+// format, as with curl -d.
+func (a *API) handleResubmitRejected(w http.ResponseWriter, r *http.Request) {
+	m, ok := a.rejected(w, r)
+	if !ok {
+		return
+	}
+	payload, contentType := m.Payload, m.ContentType
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadBytes))
+	if err != nil {
+		http.Error(w, "bad body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > 0 {
+		payload, contentType = body, r.Header.Get("Content-Type")
+		if !events.Supported(contentType) {
+			contentType = events.ContentTypeJSON
+		}
+	}
+
+	o, err := a.resubmitter.Resubmit(r.Context(), contentType, payload)
+	if merr := a.repo.MarkResubmitted(r.Context(), m.ID, err); merr != nil {
+		log.Error().Err(merr).Int64("id", m.ID).Msg("mark rejected message resubmitted")
+	}
+	var re *kafka.RejectError
+	switch {
+	case errors.As(err, &re):
+		log.Warn().Err(err).Int64("id", m.ID).Msg("resubmit rejected message")
+		res := resubmitResult{Error: err.Error()}
+		errors.As(err, &res.Violations)
+		writeJSON(w, res, http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		log.Error().Err(err).Int64("id", m.ID).Msg("resubmit rejected message")
+		writeJSON(w, resubmitResult{Error: err.Error()}, http.StatusServiceUnavailable)
+		return
+	}
+	log.Info().Int64("id", m.ID).Str("order_uid", o.OrderUID).Msg("resubmitted rejected message")
+	writeJSON(w, resubmitResult{Order: &o}, http.StatusOK)
+}
+
+func (a *API) rejected(w http.ResponseWriter, r *http.Request) (models.RejectedMessage, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return models.RejectedMessage{}, false
+	}
+	m, err := a.repo.GetRejected(r.Context(), id)
+	if errors.Is(err, repo.ErrRejectedNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return m, false
+	}
+	if err != nil {
+		log.Error().Err(err).Int64("id", id).Msg("get rejected message")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return m, false
+	}
+	return m, true
+}
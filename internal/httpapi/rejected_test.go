@@ -0,0 +1,186 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ratmirtech/techwb-l0/internal/kafka"
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/repo"
+	"github.com/ratmirtech/techwb-l0/internal/validation"
+)
+
+type fakeStore struct {
+	rejected    []models.RejectedMessage // newest last
+	resubmitted map[int64]error
+}
+
+func (s *fakeStore) FlaggedOrdersPage(context.Context, string, int) ([]models.Order, error) {
+	return []models.Order{}, nil
+}
+
+func (s *fakeStore) ListRejected(_ context.Context, before int64, limit int) ([]models.RejectedMessage, error) {
+	out := []models.RejectedMessage{}
+	for i := len(s.rejected) - 1; i >= 0 && len(out) < limit; i-- {
+		if before <= 0 || s.rejected[i].ID < before {
+			out = append(out, s.rejected[i])
+		}
+	}
+	return out, nil
+}
+
+func (s *fakeStore) GetRejected(_ context.Context, id int64) (models.RejectedMessage, error) {
+	for _, m := range s.rejected {
+		if m.ID == id {
+			return m, nil
+		}
+	}
+	return models.RejectedMessage{}, repo.ErrRejectedNotFound
+}
+
+func (s *fakeStore) MarkResubmitted(_ context.Context, id int64, cause error) error {
+	s.resubmitted[id] = cause
+	return nil
+}
+
+// fakeResubmitter records what it was given and answers with err.
+type fakeResubmitter struct {
+	err         error
+	contentType string
+	payload     []byte
+}
+
+func (r *fakeResubmitter) Resubmit(_ context.Context, contentType string, payload []byte) (models.Order, error) {
+	r.contentType, r.payload = contentType, payload
+	if r.err != nil {
+		return models.Order{}, r.err
+	}
+	return models.Order{OrderUID: "resubmitted"}, nil
+}
+
+func newRejectedAPI(token string, rs *fakeResubmitter) (http.Handler, *fakeStore) {
+	s := &fakeStore{resubmitted: make(map[int64]error)}
+	for i := int64(1); i <= 3; i++ {
+		s.rejected = append(s.rejected, models.RejectedMessage{ID: i, Topic: "orders", Offset: i,
+			ContentType: "application/x-protobuf", Payload: []byte{0xff, byte(i)}, Reason: "bad_payload"})
+	}
+	return New(newStubCache(), s, nil, rs, token).Router(), s
+}
+
+func serve(h http.Handler, method, path, token, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRejectedNeedsToken(t *testing.T) {
+	open, _ := newRejectedAPI("", &fakeResubmitter{})
+	closed, _ := newRejectedAPI("secret", &fakeResubmitter{})
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodGet, "/api/rejected"},
+		{http.MethodGet, "/api/rejected/1"},
+		{http.MethodPost, "/api/rejected/1/resubmit"},
+		{http.MethodGet, "/api/orders/flagged"},
+	} {
+		if rec := serve(open, tt.method, tt.path, "", "", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s without ADMIN_TOKEN: status %d, want 404", tt.method, tt.path, rec.Code)
+		}
+		if rec := serve(closed, tt.method, tt.path, "", "", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without a token: status %d, want 401", tt.method, tt.path, rec.Code)
+		}
+		if rec := serve(closed, tt.method, tt.path, "wrong", "", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s with a wrong token: status %d, want 401", tt.method, tt.path, rec.Code)
+		}
+	}
+}
+
+func TestListRejected(t *testing.T) {
+	h, _ := newRejectedAPI("secret", &fakeResubmitter{})
+
+	rec := serve(h, http.MethodGet, "/api/rejected?limit=2", "secret", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	var page []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0]["id"] != 3.0 || page[1]["id"] != 2.0 {
+		t.Fatalf("page %v, want ids 3 and 2", page)
+	}
+	if page[0]["payload"] != base64.StdEncoding.EncodeToString([]byte{0xff, 3}) {
+		t.Fatalf("payload %v, want base64", page[0]["payload"])
+	}
+
+	rec = serve(h, http.MethodGet, "/api/rejected?before=2", "secret", "", "")
+	var rest []models.RejectedMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &rest); err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 || rest[0].ID != 1 {
+		t.Fatalf("page before 2: %+v", rest)
+	}
+
+	for _, q := range []string{"limit=0", "limit=x", "before=x"} {
+		if rec := serve(h, http.MethodGet, "/api/rejected?"+q, "secret", "", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", q, rec.Code)
+		}
+	}
+	if rec := serve(h, http.MethodGet, "/api/rejected/9", "secret", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown id: status %d", rec.Code)
+	}
+}
+
+func TestResubmitRejected(t *testing.T) {
+	invalid := &kafka.RejectError{Reason: "invalid_order", Err: validation.Errors{{Field: "items", Message: "must contain at least one item"}}}
+	for _, tt := range []struct {
+		name        string
+		err         error
+		contentType string
+		body        string
+		code        int
+		wantType    string
+		wantPayload string
+	}{
+		{"stored payload", nil, "", "", http.StatusOK, "application/x-protobuf", "\xff\x01"},
+		{"json body", nil, "application/json", `{"order_uid":"x"}`, http.StatusOK, "application/json", `{"order_uid":"x"}`},
+		{"curl -d body", nil, "application/x-www-form-urlencoded", `{"order_uid":"x"}`, http.StatusOK, "application/json", `{"order_uid":"x"}`},
+		{"invalid order", invalid, "", "", http.StatusUnprocessableEntity, "application/x-protobuf", "\xff\x01"},
+		{"store down", errors.New("save order: connection refused"), "", "", http.StatusServiceUnavailable, "application/x-protobuf", "\xff\x01"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := &fakeResubmitter{err: tt.err}
+			h, s := newRejectedAPI("secret", rs)
+			rec := serve(h, http.MethodPost, "/api/rejected/1/resubmit", "secret", tt.contentType, tt.body)
+			if rec.Code != tt.code {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+			if rs.contentType != tt.wantType || string(rs.payload) != tt.wantPayload {
+				t.Fatalf("resubmitted %q as %q", rs.payload, rs.contentType)
+			}
+			var res resubmitResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if tt.err == invalid && len(res.Violations) != 1 {
+				t.Fatalf("violations %+v", res.Violations)
+			}
+			if cause, ok := s.resubmitted[1]; !ok || !errors.Is(cause, tt.err) {
+				t.Fatalf("marked resubmitted with %v, %v", cause, ok)
+			}
+		})
+	}
+}
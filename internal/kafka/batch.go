@@ -0,0 +1,152 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/repo"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/rs/zerolog/log"
+)
+
+func (c *Consumer) runBatches(ctx context.Context) error {
+	for {
+		msgs, err := c.fetchBatch(ctx)
+		if len(msgs) > 0 {
+			if perr := c.processBatch(ctx, msgs); perr != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return perr
+			}
+		}
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			log.Error().Err(err).Msg("Failed to read message")
+			return err
+		}
+	}
+}
+
+// fetchBatch blocks for the first message, then collects more until the batch
+// is full or batchWait has passed since the first one arrived.
+func (c *Consumer) fetchBatch(ctx context.Context) ([]kafka.Message, error) {
+	m, err := c.reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]kafka.Message, 1, c.batchSize)
+	msgs[0] = m
+
+	wctx, cancel := context.WithTimeout(ctx, c.batchWait)
+	defer cancel()
+	for len(msgs) < c.batchSize {
+		m, err := c.reader.FetchMessage(wctx)
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				break
+			}
+			return msgs, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, nil
+}
+
+// processBatch stores every decodable order of msgs in one transaction and then
+// commits them. If the batch fails permanently
+// the orders are retried one by one so a single poison message is dead-lettered
+// alone.
+func (c *Consumer) processBatch(ctx context.Context, msgs []kafka.Message) error {
+	started := time.Now()
+	orders := make([]models.Order, 0, len(msgs))
+	sources := make([]kafka.Message, 0, len(msgs))
+	for _, m := range msgs {
+		order, err := c.decodeOrder(ctx, contentType(m), m.Value)
+		if err != nil {
+			var re *RejectError
+			if !errors.As(err, &re) {
+				return err
+			}
+			if err := c.disposeBad(ctx, m, re); err != nil {
+				return err
+			}
+			continue
+		}
+		orders = append(orders, order)
+		sources = append(sources, m)
+	}
+
+	stored := false
+	if len(orders) > 0 {
+		err := c.upsertBatch(ctx, orders, msgs)
+		var re *RejectError
+		switch {
+		case err == nil:
+			stored = true
+			for _, o := range orders {
+				c.cached(o)
+			}
+		case errors.As(err, &re), errors.Is(err, repo.ErrAlreadyApplied):
+			log.Warn().Err(err).Int("orders", len(orders)).Msg("Batch failed, saving orders one by one")
+			if err := c.saveEach(ctx, orders, sources); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+
+	if !stored {
+		c.saveOffsets(ctx, msgs...)
+	}
+	c.commit(ctx, msgs...)
+	log.Info().Int("messages", len(msgs)).Int("orders", len(orders)).Dur("elapsed", time.Since(started)).
+		Msg("Processed batch")
+	return nil
+}
+
+func (c *Consumer) saveEach(ctx context.Context, orders []models.Order, sources []kafka.Message) error {
+	for i, o := range orders {
+		err := c.upsert(ctx, o, sources[i])
+		if err == nil {
+			c.cached(o)
+			continue
+		}
+		if errors.Is(err, repo.ErrAlreadyApplied) {
+			log.Info().Str("order_uid", o.OrderUID).Int64("offset", sources[i].Offset).
+				Msg("Message already applied, skipping")
+			continue
+		}
+		var re *RejectError
+		if !errors.As(err, &re) {
+			return err
+		}
+		log.Error().Err(err).Str("order_uid", o.OrderUID).Msg("Giving up on message")
+		if err := c.deadLetter(ctx, sources[i], re); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lastPerPartition keeps the highest-offset message of each partition; committing
+// it covers everything before it.
+func lastPerPartition(msgs []kafka.Message) []kafka.Message {
+	last := make(map[int]int, 1)
+	for i, m := range msgs {
+		if j, ok := last[m.Partition]; !ok || m.Offset > msgs[j].Offset {
+			last[m.Partition] = i
+		}
+	}
+	out := make([]kafka.Message, 0, len(last))
+	for _, i := range last {
+		out = append(out, msgs[i])
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// BenchmarkProcess compares storing messages one by one with storing them in
+// batches, against a store whose writes take a fixed round trip.
+func BenchmarkProcess(b *testing.B) {
+	const messages = 500
+	msgs := make([]kafka.Message, messages)
+	for i := range msgs {
+		msgs[i] = kafka.Message{Topic: "orders", Offset: int64(i), Value: testPayload(b, testOrder(fmt.Sprintf("order-%d", i)))}
+	}
+	ctx := context.Background()
+
+	for _, latency := range []time.Duration{0, 200 * time.Microsecond} {
+		s := newFakeStore()
+		s.latency = latency
+		c := newTestConsumer(newFakeReader(), s, BadMessageDLQ)
+
+		b.Run(fmt.Sprintf("one/latency=%v", latency), func(b *testing.B) {
+			for b.Loop() {
+				for _, m := range msgs {
+					if err := c.processOne(ctx, m); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(b.N*messages)/b.Elapsed().Seconds(), "msgs/s")
+		})
+		for _, size := range []int{10, 100} {
+			b.Run(fmt.Sprintf("batch=%d/latency=%v", size, latency), func(b *testing.B) {
+				for b.Loop() {
+					for i := 0; i < len(msgs); i += size {
+						if err := c.processBatch(ctx, msgs[i:min(i+size, len(msgs))]); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+				b.ReportMetric(float64(b.N*messages)/b.Elapsed().Seconds(), "msgs/s")
+			})
+		}
+	}
+}
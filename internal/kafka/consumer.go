@@ -2,27 +2,87 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/ratmirtech/techwb-l0/internal/cache"
 	"github.com/ratmirtech/techwb-l0/internal/config"
+	"github.com/ratmirtech/techwb-l0/internal/events"
 	"github.com/ratmirtech/techwb-l0/internal/models"
 	"github.com/ratmirtech/techwb-l0/internal/repo"
+	"github.com/ratmirtech/techwb-l0/internal/schemaregistry"
+	"github.com/ratmirtech/techwb-l0/internal/validation"
 	"github.com/segmentio/kafka-go"
 
 	"github.com/rs/zerolog/log"
 )
 
+// RejectError means a message can never be processed as it is.
+type RejectError struct {
+	Reason string
+	Err    error
+}
+
+func (e *RejectError) Error() string { return fmt.Sprintf("%s: %v", e.Reason, e.Err) }
+
+func (e *RejectError) Unwrap() error { return e.Err }
+
+const (
+	BadMessageSkip = "skip"
+	BadMessageDLQ  = "dlq"
+	BadMessageHalt = "halt"
+)
+
+// resubmitTimeout bounds the save retries of a resubmission, which an operator
+// is waiting on.
+const resubmitTimeout = 30 * time.Second
+
+const (
+	DispatchPartition = "partition"
+	DispatchKey       = "key"
+)
+
+// messageReader is the part of *kafka.Reader the consumer uses.
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Config() kafka.ReaderConfig
+	Close() error
+}
+
+// orderStore is the part of *repo.PG the consumer writes through.
+type orderStore interface {
+	UpsertOrder(ctx context.Context, o models.Order) error
+	UpsertOrders(ctx context.Context, orders []models.Order) error
+	UpsertOrdersAt(ctx context.Context, group string, orders []models.Order, at []repo.Offset) error
+	SaveOffsets(ctx context.Context, group string, at []repo.Offset) error
+	SaveRejected(ctx context.Context, m models.RejectedMessage) error
+}
+
 type Consumer struct {
-	reader *kafka.Reader
-	repo   *repo.PG
-	cache  *cache.Store
+	reader       messageReader
+	dlq          *deadLetters
+	retry        retryPolicy
+	badMessage   string
+	batchSize    int
+	batchWait    time.Duration
+	workers      int
+	dispatch     string
+	drainTimeout time.Duration
+	offsets      *offsetTracker // set while a worker pool runs
+	exactlyOnce  bool
+	group        string
+	reconcile    string
+	avro         *events.Avro // nil without a schema registry
+	repo         orderStore
+	cache        cache.OrderCache
+	negative     *cache.Negative
 }
 
-func NewConsumer(cfg config.Config, r *repo.PG, c *cache.Store) *Consumer {
-	reader := kafka.NewReader(kafka.ReaderConfig{
+func NewConsumer(cfg config.Config, r *repo.PG, c cache.OrderCache, neg *cache.Negative) *Consumer {
+	readerCfg := kafka.ReaderConfig{
 		Brokers:        cfg.KafkaBrokers,
 		GroupID:        cfg.KafkaGroupID,
 		Topic:          cfg.KafkaTopic,
@@ -30,14 +90,90 @@ func NewConsumer(cfg config.Config, r *repo.PG, c *cache.Store) *Consumer {
 		MaxBytes:       10e6,
 		MaxWait:        500 * time.Millisecond,
 		CommitInterval: 0,
-	})
-	return &Consumer{reader: reader, repo: r, cache: c}
+	}
+	var reader messageReader
+	exactlyOnce := cfg.KafkaExactlyOnce
+	if exactlyOnce {
+		gr, err := newGroupReader(readerCfg, func(ctx context.Context) (map[int]int64, error) {
+			return r.Offsets(ctx, cfg.KafkaGroupID, cfg.KafkaTopic)
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Can't resume from stored offsets, using group offsets")
+			exactlyOnce = false
+		} else {
+			reader = gr
+		}
+	}
+	if reader == nil {
+		reader = kafka.NewReader(readerCfg)
+	}
+	policy := strings.ToLower(cfg.KafkaBadMessagePolicy)
+	switch policy {
+	case BadMessageSkip, BadMessageDLQ, BadMessageHalt:
+	default:
+		log.Warn().Str("policy", cfg.KafkaBadMessagePolicy).Msg("Unknown bad message policy, using dlq")
+		policy = BadMessageDLQ
+	}
+	dispatch := strings.ToLower(cfg.KafkaDispatch)
+	if dispatch != DispatchPartition && dispatch != DispatchKey {
+		log.Warn().Str("dispatch", cfg.KafkaDispatch).Msg("Unknown dispatch mode, using partition")
+		dispatch = DispatchPartition
+	}
+	if exactlyOnce && dispatch == DispatchKey && cfg.KafkaWorkers > 1 {
+		// offsets are stored per partition, so a partition must stay on one worker
+		log.Warn().Msg("Key dispatch can't keep stored offsets in order, using partition")
+		dispatch = DispatchPartition
+	}
+	reconcile := strings.ToLower(cfg.ReconcileMode)
+	switch reconcile {
+	case validation.ReconcileReject, validation.ReconcileFlag, validation.ReconcileIgnore:
+	default:
+		log.Warn().Str("mode", cfg.ReconcileMode).Msg("Unknown reconcile mode, using flag")
+		reconcile = validation.ReconcileFlag
+	}
+	var avroCodec *events.Avro
+	if cfg.SchemaRegistryURL != "" {
+		avroCodec = events.NewAvro(schemaregistry.New(cfg.SchemaRegistryURL), cfg.KafkaTopic+"-value")
+	}
+	return &Consumer{
+		reader:       reader,
+		dlq:          newDeadLetters(cfg),
+		badMessage:   policy,
+		batchSize:    cfg.KafkaBatchSize,
+		batchWait:    cfg.KafkaBatchWait,
+		workers:      max(cfg.KafkaWorkers, 1),
+		dispatch:     dispatch,
+		drainTimeout: cfg.KafkaDrainTimeout,
+		exactlyOnce:  exactlyOnce,
+		group:        cfg.KafkaGroupID,
+		reconcile:    reconcile,
+		avro:         avroCodec,
+		retry: retryPolicy{
+			maxAttempts: cfg.KafkaRetryMaxAttempts,
+			baseDelay:   cfg.KafkaRetryBaseDelay,
+			maxDelay:    cfg.KafkaRetryMaxDelay,
+		},
+		repo:     r,
+		cache:    c,
+		negative: neg,
+	}
 }
 
 func (c *Consumer) Run(ctx context.Context) error {
 	log.Info().Strs("brokers", c.reader.Config().Brokers).Str("topic", c.reader.Config().Topic).
-		Str("group", c.reader.Config().GroupID).Msg("Starting Kafka consumer")
+		Str("group", c.reader.Config().GroupID).Int("batch_size", c.batchSize).Int("workers", c.workers).Bool("exactly_once", c.exactlyOnce).
+		Msg("Starting Kafka consumer")
 
+	if c.workers > 1 {
+		return c.runWorkers(ctx)
+	}
+	if c.batchSize > 1 {
+		return c.runBatches(ctx)
+	}
+	return c.runSingle(ctx)
+}
+
+func (c *Consumer) runSingle(ctx context.Context) error {
 	for {
 		m, err := c.reader.FetchMessage(ctx)
 		if err != nil {
@@ -47,41 +183,282 @@ func (c *Consumer) Run(ctx context.Context) error {
 			log.Error().Err(err).Msg("Failed to read message")
 			return err
 		}
+		if err := c.processOne(ctx, m); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
 
-		log.Info().Str("key", string(m.Key)).Msg("Got a message")
+// processOne stores and commits a single message. It returns an error only when
+// the consumer has to stop: a halting bad message or a cancelled ctx.
+func (c *Consumer) processOne(ctx context.Context, m kafka.Message) error {
+	log.Info().Str("key", string(m.Key)).Msg("Got a message")
 
-		var order models.Order
-		if err := json.Unmarshal(m.Value, &order); err != nil {
-			log.Error().Err(err).Str("value", string(m.Value)).Msg("Bad JSON, skipping")
-			time.Sleep(300 * time.Millisecond)
-			continue
+	order, err := c.decodeOrder(ctx, contentType(m), m.Value)
+	if err != nil {
+		var re *RejectError
+		if !errors.As(err, &re) {
+			return err
 		}
+		return c.handleBadMessage(ctx, m, re)
+	}
 
-		log.Info().Str("order_uid", order.OrderUID).Msg("Parsed order")
+	log.Info().Str("order_uid", order.OrderUID).Msg("Parsed order")
 
-		if order.OrderUID == "" || order.Payment.Transaction == "" {
-			log.Warn().Str("key", string(m.Key)).Msg("Invalid order, skipping")
-			_ = c.reader.CommitMessages(ctx, m)
-			continue
+	if err := c.upsert(ctx, order, m); err != nil {
+		if errors.Is(err, repo.ErrAlreadyApplied) {
+			log.Info().Str("order_uid", order.OrderUID).Int64("offset", m.Offset).Msg("Message already applied, skipping")
+			c.commit(ctx, m)
+			return nil
 		}
+		var re *RejectError
+		if !errors.As(err, &re) {
+			return err
+		}
+		log.Error().Err(err).Str("order_uid", order.OrderUID).Msg("Giving up on message")
+		return c.reject(ctx, m, re)
+	}
+
+	log.Info().Str("order_uid", order.OrderUID).Msg("Saved to DB")
+
+	c.cached(order)
+
+	if c.commit(ctx, m) {
+		log.Info().Str("order_uid", order.OrderUID).Msg("Message committed")
+	}
+	return nil
+}
 
-		if err := c.repo.UpsertOrder(ctx, order); err != nil {
-			log.Error().Err(err).Str("order_uid", order.OrderUID).Msg("Failed to save to DB, will retry")
-			time.Sleep(500 * time.Millisecond)
-			continue
+// decodeOrder returns a *RejectError for payloads that can never be stored;
+// any other error means ctx was cancelled. Payment inconsistencies are
+// rejected, flagged on the order or ignored depending on the reconcile mode.
+func (c *Consumer) decodeOrder(ctx context.Context, contentType string, value []byte) (models.Order, error) {
+	env, order, err := c.decode(ctx, contentType, value)
+	if err != nil {
+		var re *RejectError
+		if errors.As(err, &re) || ctx.Err() != nil {
+			return order, err
+		}
+		reason := reasonBadJSON
+		switch {
+		case errors.Is(err, events.ErrUnsupportedContentType):
+			reason = reasonUnsupportedContentType
+		case events.IsAvro(contentType, value), !events.IsJSON(contentType):
+			reason = reasonBadPayload
+		case errors.Is(err, events.ErrUnsupportedVersion):
+			reason = reasonUnsupportedVersion
+		case errors.Is(err, events.ErrUnknownField):
+			reason = reasonUnknownField
+		case errors.Is(err, events.ErrInvalidEnvelope), errors.Is(err, events.ErrUnknownEventType):
+			reason = reasonBadEnvelope
 		}
+		return order, &RejectError{Reason: reason, Err: err}
+	}
+	if env.SchemaVersion > 0 {
+		log.Debug().Int("schema_version", env.SchemaVersion).Str("event_type", env.EventType).
+			Str("producer", env.Producer).Time("emitted_at", env.EmittedAt).Msg("Decoded envelope")
+	}
+	if errs := validation.Order(order); len(errs) > 0 {
+		return order, &RejectError{Reason: reasonInvalidOrder, Err: errs}
+	}
+	order.Flags = nil
+	if c.reconcile == validation.ReconcileIgnore {
+		return order, nil
+	}
+	if errs := validation.Reconcile(order); len(errs) > 0 {
+		if c.reconcile == validation.ReconcileReject {
+			return order, &RejectError{Reason: reasonInconsistentOrder, Err: errs}
+		}
+		log.Warn().Str("order_uid", order.OrderUID).Err(errs).Msg("Order payment is inconsistent, flagging")
+		order.Flags = errs.Flags()
+	}
+	return order, nil
+}
 
-		log.Info().Str("order_uid", order.OrderUID).Msg("Saved to DB")
+// decode picks the decoder by content type. Avro writer schemas come from the
+// schema registry, which is retried like the database while it is unreachable.
+func (c *Consumer) decode(ctx context.Context, contentType string, value []byte) (events.Envelope, models.Order, error) {
+	if c.avro == nil || !events.IsAvro(contentType, value) {
+		return events.DecodeAs(contentType, value)
+	}
+	for attempt := 1; ; attempt++ {
+		order, err := c.avro.Decode(ctx, value)
+		if !errors.Is(err, schemaregistry.ErrUnavailable) {
+			return events.Envelope{}, order, err
+		}
+		if c.retry.maxAttempts > 0 && attempt >= c.retry.maxAttempts {
+			return events.Envelope{}, order, &RejectError{Reason: reasonRetriesExhausted, Err: err}
+		}
+		d := c.retry.delay(attempt)
+		log.Error().Err(err).Int("attempt", attempt).Dur("retry_in", d).Msg("Failed to fetch Avro schema, will retry")
+		select {
+		case <-ctx.Done():
+			return events.Envelope{}, order, ctx.Err()
+		case <-time.After(d):
+		}
+	}
+}
 
-		c.cache.Set(order)
-		log.Info().Str("order_uid", order.OrderUID).Msg("Cached order")
+func contentType(m kafka.Message) string {
+	for _, h := range m.Headers {
+		if strings.EqualFold(h.Key, events.HeaderContentType) {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
 
-		if err := c.reader.CommitMessages(ctx, m); err != nil {
-			log.Error().Err(err).Str("order_uid", order.OrderUID).Msg("Failed to commit")
-		} else {
-			log.Info().Str("order_uid", order.OrderUID).Msg("Message committed")
+func (c *Consumer) cached(order models.Order) {
+	c.cache.Set(order)
+	c.negative.Forget(order.OrderUID)
+	log.Info().Str("order_uid", order.OrderUID).Msg("Cached order")
+}
+
+// Resubmit runs a previously rejected payload through the same decoding and
+// storage steps as a Kafka message, bypassing the topic. Only a payload that
+// can never be stored comes back as a *RejectError; a failed save does not.
+func (c *Consumer) Resubmit(ctx context.Context, contentType string, payload []byte) (models.Order, error) {
+	order, err := c.decodeOrder(ctx, contentType, payload)
+	if err != nil {
+		return order, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, resubmitTimeout)
+	defer cancel()
+	err = c.retrying(ctx, order.OrderUID, func() error { return c.repo.UpsertOrder(ctx, order) })
+	if err != nil {
+		var re *RejectError
+		if errors.As(err, &re) {
+			err = re.Err
 		}
+		return order, fmt.Errorf("save order: %w", err)
+	}
+	c.cached(order)
+	return order, nil
+}
+
+// handleBadMessage applies the configured policy to a message that cannot be
+// decoded into a valid order. Every policy but halt commits the offset so the
+// partition keeps moving.
+func (c *Consumer) handleBadMessage(ctx context.Context, m kafka.Message, re *RejectError) error {
+	if err := c.disposeBad(ctx, m, re); err != nil {
+		return err
+	}
+	c.saveOffsets(ctx, m)
+	c.commit(ctx, m)
+	return nil
+}
+
+// disposeBad is handleBadMessage without the commit, for callers that commit
+// a whole batch at once.
+func (c *Consumer) disposeBad(ctx context.Context, m kafka.Message, re *RejectError) error {
+	l := log.Warn().Err(re).Str("policy", c.badMessage).Str("topic", m.Topic).Int("partition", m.Partition).
+		Int64("offset", m.Offset).Str("value", string(m.Value))
+	switch c.badMessage {
+	case BadMessageHalt:
+		l.Msg("Bad message, halting consumer")
+		return fmt.Errorf("bad message at %s/%d@%d: %w", m.Topic, m.Partition, m.Offset, re)
+	case BadMessageSkip:
+		l.Msg("Bad message, skipping")
+		return nil
+	default:
+		l.Msg("Bad message, dead-lettering")
+		return c.deadLetter(ctx, m, re)
 	}
 }
 
-func (c *Consumer) Close() { _ = c.reader.Close() }
+// reject dead-letters m, then commits it. It only fails when ctx is cancelled.
+func (c *Consumer) reject(ctx context.Context, m kafka.Message, re *RejectError) error {
+	if err := c.deadLetter(ctx, m, re); err != nil {
+		return err
+	}
+	c.saveOffsets(ctx, m)
+	c.commit(ctx, m)
+	return nil
+}
+
+// deadLetter quarantines m in Postgres and publishes it to the dead-letter topic.
+func (c *Consumer) deadLetter(ctx context.Context, m kafka.Message, re *RejectError) error {
+	err := c.repo.SaveRejected(ctx, models.RejectedMessage{
+		Topic:       m.Topic,
+		Partition:   m.Partition,
+		Offset:      m.Offset,
+		Key:         string(m.Key),
+		ContentType: contentType(m),
+		Payload:     m.Value,
+		Reason:      re.Reason,
+		Error:       re.Err.Error(),
+	})
+	if err != nil {
+		log.Error().Err(err).Int64("offset", m.Offset).Msg("Failed to quarantine rejected message")
+	}
+	return c.dlq.publish(ctx, m, re.Reason, re.Err)
+}
+
+// commit marks msgs as processed. With a worker pool only the offsets every
+// earlier message of the partition has caught up with are committed.
+func (c *Consumer) commit(ctx context.Context, msgs ...kafka.Message) bool {
+	if c.offsets != nil {
+		c.offsets.mu.Lock()
+		defer c.offsets.mu.Unlock()
+		msgs = c.offsets.complete(msgs)
+		if len(msgs) == 0 {
+			return true
+		}
+	} else {
+		msgs = lastPerPartition(msgs)
+	}
+	if err := c.reader.CommitMessages(ctx, msgs...); err != nil {
+		log.Error().Err(err).Int("messages", len(msgs)).Msg("Failed to commit")
+		return false
+	}
+	return true
+}
+
+// saveOffsets stores the offsets of messages that were handled without an order
+// write, so they are not replayed from Postgres after a restart.
+func (c *Consumer) saveOffsets(ctx context.Context, msgs ...kafka.Message) {
+	if !c.exactlyOnce {
+		return
+	}
+	if err := c.repo.SaveOffsets(ctx, c.group, positions(msgs)); err != nil {
+		log.Error().Err(err).Int("messages", len(msgs)).Msg("Failed to store offsets")
+	}
+}
+
+func positions(msgs []kafka.Message) []repo.Offset {
+	last := lastPerPartition(msgs)
+	out := make([]repo.Offset, len(last))
+	for i, m := range last {
+		out[i] = repo.Offset{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset}
+	}
+	return out
+}
+
+// batchPositions is positions preceded by the first offset of every partition
+// with more than one message. Offsets are stored in order, so a batch that
+// starts at an already applied offset is rejected as a whole instead of only
+// when its last message was applied too.
+func batchPositions(msgs []kafka.Message) []repo.Offset {
+	first := make(map[int]kafka.Message, 1)
+	for _, m := range msgs {
+		if f, ok := first[m.Partition]; !ok || m.Offset < f.Offset {
+			first[m.Partition] = m
+		}
+	}
+	last := positions(msgs)
+	out := make([]repo.Offset, 0, 2*len(last))
+	for _, l := range last {
+		if f := first[l.Partition]; f.Offset < l.Offset {
+			out = append(out, repo.Offset{Topic: f.Topic, Partition: f.Partition, Offset: f.Offset})
+		}
+	}
+	return append(out, last...)
+}
+
+func (c *Consumer) Close() {
+	_ = c.reader.Close()
+	c.dlq.Close()
+}
@@ -0,0 +1,487 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/ratmirtech/techwb-l0/internal/cache"
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/repo"
+	"github.com/ratmirtech/techwb-l0/internal/validation"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestMain(m *testing.M) {
+	log.Logger = zerolog.New(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeReader serves a scripted partition and records commits. Once the script
+// runs out FetchMessage reports context.Canceled, which stops the consumer, or
+// with block set waits for ctx like a reader on an idle topic.
+type fakeReader struct {
+	mu        sync.Mutex
+	msgs      []kafka.Message
+	next      int
+	block     bool
+	committed []kafka.Message
+}
+
+func newFakeReader(values ...[]byte) *fakeReader {
+	r := &fakeReader{}
+	for i, v := range values {
+		r.msgs = append(r.msgs, kafka.Message{Topic: "orders", Partition: 0, Offset: int64(i), Value: v})
+	}
+	return r
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if err := ctx.Err(); err != nil {
+		r.mu.Unlock()
+		return kafka.Message{}, err
+	}
+	if r.next == len(r.msgs) {
+		r.mu.Unlock()
+		if r.block {
+			<-ctx.Done()
+			return kafka.Message{}, ctx.Err()
+		}
+		return kafka.Message{}, context.Canceled
+	}
+	defer r.mu.Unlock()
+	r.next++
+	return r.msgs[r.next-1], nil
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *fakeReader) Config() kafka.ReaderConfig {
+	return kafka.ReaderConfig{Topic: "orders", GroupID: "test"}
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+// lastCommitted returns the highest committed offset, or -1.
+func (r *fakeReader) lastCommitted() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := int64(-1)
+	for _, m := range r.committed {
+		last = max(last, m.Offset)
+	}
+	return last
+}
+
+// fakeStore keeps saved orders, offsets and rejected messages in memory.
+// latency is added to every order write, standing in for a database round
+// trip, and a set err fails every order write. Offsets only move forward, like
+// the kafka_offsets table.
+type fakeStore struct {
+	mu       sync.Mutex
+	latency  time.Duration
+	err      error
+	orders   map[string]models.Order
+	offsets  map[int]int64
+	rejected []models.RejectedMessage
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{orders: make(map[string]models.Order), offsets: make(map[int]int64)}
+}
+
+func (s *fakeStore) UpsertOrder(ctx context.Context, o models.Order) error {
+	return s.UpsertOrders(ctx, []models.Order{o})
+}
+
+func (s *fakeStore) UpsertOrders(_ context.Context, orders []models.Order) error {
+	if s.latency > 0 {
+		time.Sleep(s.latency)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	for _, o := range orders {
+		s.orders[o.OrderUID] = o
+	}
+	return nil
+}
+
+// UpsertOrdersAt writes nothing if any offset in at is not past the one stored
+// when it is reached, the way the transaction in repo does.
+func (s *fakeStore) UpsertOrdersAt(_ context.Context, _ string, orders []models.Order, at []repo.Offset) error {
+	if s.latency > 0 {
+		time.Sleep(s.latency)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	offsets := maps.Clone(s.offsets)
+	if advanceOffsets(offsets, at) {
+		return repo.ErrAlreadyApplied
+	}
+	for _, o := range orders {
+		s.orders[o.OrderUID] = o
+	}
+	s.offsets = offsets
+	return nil
+}
+
+func (s *fakeStore) SaveOffsets(_ context.Context, _ string, at []repo.Offset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	advanceOffsets(s.offsets, at)
+	return nil
+}
+
+// advanceOffsets moves offsets forward to at and reports whether any of them
+// was already stored.
+func advanceOffsets(offsets map[int]int64, at []repo.Offset) (stale bool) {
+	for _, o := range at {
+		if stored, ok := offsets[o.Partition]; ok && stored >= o.Offset {
+			stale = true
+			continue
+		}
+		offsets[o.Partition] = o.Offset
+	}
+	return stale
+}
+
+func (s *fakeStore) SaveRejected(_ context.Context, m models.RejectedMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejected = append(s.rejected, m)
+	return nil
+}
+
+func testOrder(uid string) models.Order {
+	track := "TRACK-" + uid
+	return models.Order{
+		OrderUID:        uid,
+		TrackNumber:     track,
+		Entry:           "WBIL",
+		Delivery:        models.Delivery{Name: "Test Testov", Phone: "+9720000000", City: "Kiryat Mozkin", Address: "Ploshad Mira 15"},
+		Payment:         models.Payment{Transaction: uid, Currency: "USD", Provider: "wbpay", Amount: 1817, GoodsTotal: 317, DeliveryCost: 1500},
+		Items:           []models.Item{{ChrtID: 9934930, TrackNumber: track, Price: 453, Name: "Mascaras", Sale: 30, TotalPrice: 317, NmID: 2389212, Status: 202}},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+	}
+}
+
+func testPayload(tb testing.TB, o models.Order) []byte {
+	b, err := json.Marshal(o)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+func newTestConsumer(r messageReader, s orderStore, policy string) *Consumer {
+	return &Consumer{
+		reader:     r,
+		dlq:        &deadLetters{},
+		badMessage: policy,
+		batchWait:  10 * time.Millisecond,
+		workers:    1,
+		reconcile:  validation.ReconcileFlag,
+		retry:      retryPolicy{maxAttempts: 1},
+		repo:       s,
+		cache:      cache.Noop{},
+		negative:   cache.NewNegative(0, 0),
+	}
+}
+
+func TestBadMessagePolicies(t *testing.T) {
+	invalid := testOrder("invalid")
+	invalid.Items = nil
+
+	for _, batchSize := range []int{1, 10} {
+		for _, tt := range []struct {
+			policy   string
+			wantErr  bool
+			saved    int
+			rejected int
+			// committed is the highest offset committed, -1 for none
+			committed int64
+		}{
+			{BadMessageSkip, false, 2, 0, 3},
+			{BadMessageDLQ, false, 2, 2, 3},
+			{BadMessageHalt, true, 0, 0, -1},
+		} {
+			t.Run(fmt.Sprintf("%s/batch=%d", tt.policy, batchSize), func(t *testing.T) {
+				r := newFakeReader(
+					[]byte(`{"order_uid": `),
+					testPayload(t, testOrder("a")),
+					testPayload(t, invalid),
+					testPayload(t, testOrder("b")),
+				)
+				if tt.policy == BadMessageHalt {
+					// only the leading bad message, so nothing valid precedes it
+					r.msgs = r.msgs[:1]
+				}
+				s := newFakeStore()
+				c := newTestConsumer(r, s, tt.policy)
+				c.batchSize = batchSize
+
+				err := c.Run(context.Background())
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Run: %v, want error %v", err, tt.wantErr)
+				}
+				if len(s.orders) != tt.saved {
+					t.Fatalf("saved %d orders, want %d", len(s.orders), tt.saved)
+				}
+				if len(s.rejected) != tt.rejected {
+					t.Fatalf("quarantined %d messages, want %d", len(s.rejected), tt.rejected)
+				}
+				if got := r.lastCommitted(); got != tt.committed {
+					t.Fatalf("committed up to %d, want %d", got, tt.committed)
+				}
+			})
+		}
+	}
+}
+
+func TestHaltStopsAtBadMessage(t *testing.T) {
+	r := newFakeReader(
+		testPayload(t, testOrder("a")),
+		[]byte("not json"),
+		testPayload(t, testOrder("b")),
+	)
+	s := newFakeStore()
+	err := newTestConsumer(r, s, BadMessageHalt).Run(context.Background())
+
+	var re *RejectError
+	if !errors.As(err, &re) || re.Reason != reasonBadJSON {
+		t.Fatalf("Run: %v, want a bad_json rejection", err)
+	}
+	if got := r.lastCommitted(); got != 0 {
+		t.Fatalf("committed up to %d, want only the message before the bad one", got)
+	}
+	if _, ok := s.orders["b"]; ok {
+		t.Fatal("consumed past the bad message")
+	}
+}
+
+func TestResubmitClassifiesErrors(t *testing.T) {
+	s := newFakeStore()
+	c := newTestConsumer(newFakeReader(), s, BadMessageDLQ)
+	ctx := context.Background()
+
+	var re *RejectError
+	if _, err := c.Resubmit(ctx, "", []byte("not json")); !errors.As(err, &re) || re.Reason != reasonBadJSON {
+		t.Fatalf("bad payload: %v, want a bad_json rejection", err)
+	}
+	if o, err := c.Resubmit(ctx, "", testPayload(t, testOrder("a"))); err != nil || s.orders["a"].OrderUID != o.OrderUID {
+		t.Fatalf("valid payload: %v", err)
+	}
+
+	// retries run out, but a failed save is still not the payload's fault
+	s.err = errors.New("connection refused")
+	_, err := c.Resubmit(ctx, "", testPayload(t, testOrder("b")))
+	if err == nil || errors.As(err, &re) || !errors.Is(err, s.err) {
+		t.Fatalf("store failure: %v, want the store error without a rejection", err)
+	}
+}
+
+// flakyStore fails the first failures order writes with err.
+type flakyStore struct {
+	*fakeStore
+	err      error
+	failures int
+	calls    int
+}
+
+func (s *flakyStore) UpsertOrders(ctx context.Context, orders []models.Order) error {
+	s.calls++
+	if s.calls <= s.failures {
+		return s.err
+	}
+	return s.fakeStore.UpsertOrders(ctx, orders)
+}
+
+func (s *flakyStore) UpsertOrder(ctx context.Context, o models.Order) error {
+	return s.UpsertOrders(ctx, []models.Order{o})
+}
+
+func TestRetryBudget(t *testing.T) {
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	for _, tt := range []struct {
+		name     string
+		err      error
+		saved    bool
+		rejected string
+	}{
+		{"connection errors outlast the budget", dial, true, ""},
+		{"server shutdown outlasts the budget", &pgconn.PgError{Code: "57P01"}, true, ""},
+		{"other errors use it up", &pgconn.PgError{Code: "40001"}, false, reasonRetriesExhausted},
+		{"permanent errors skip it", &pgconn.PgError{Code: "23505"}, false, reasonPermanentDBError},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &flakyStore{fakeStore: newFakeStore(), err: tt.err, failures: 5}
+			c := newTestConsumer(newFakeReader(), s, BadMessageDLQ)
+			c.retry = retryPolicy{maxAttempts: 2}
+
+			err := c.upsert(context.Background(), testOrder("a"), kafka.Message{})
+			if _, ok := s.orders["a"]; ok != tt.saved {
+				t.Fatalf("saved %v after %d calls, want %v", ok, s.calls, tt.saved)
+			}
+			var re *RejectError
+			if tt.rejected == "" {
+				if err != nil {
+					t.Fatalf("upsert: %v", err)
+				}
+			} else if !errors.As(err, &re) || re.Reason != tt.rejected {
+				t.Fatalf("upsert: %v, want a %s rejection", err, tt.rejected)
+			}
+		})
+	}
+}
+
+func TestExactlyOnceSkipsReplays(t *testing.T) {
+	for _, batchSize := range []int{1, 10} {
+		t.Run(fmt.Sprintf("batch=%d", batchSize), func(t *testing.T) {
+			replayed := testOrder("a")
+			replayed.CustomerID = "replayed"
+			r := newFakeReader(
+				testPayload(t, replayed),
+				testPayload(t, testOrder("b")),
+				testPayload(t, testOrder("c")),
+				[]byte("not json"),
+			)
+			s := newFakeStore()
+			// offsets 0 and 1 were applied before a crash that lost the Kafka commit
+			s.orders["a"] = testOrder("a")
+			s.offsets[0] = 1
+			c := newTestConsumer(r, s, BadMessageDLQ)
+			c.batchSize = batchSize
+			c.exactlyOnce = true
+			c.group = "test"
+
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if s.orders["a"].CustomerID != "test" {
+				t.Fatal("a replayed message overwrote the stored order")
+			}
+			if _, ok := s.orders["b"]; ok {
+				t.Fatal("stored a replayed message")
+			}
+			if _, ok := s.orders["c"]; !ok {
+				t.Fatal("new message not stored")
+			}
+			// the bad message stores no order, but its offset still advances
+			if s.offsets[0] != 3 {
+				t.Fatalf("stored offset %d, want 3", s.offsets[0])
+			}
+			if got := r.lastCommitted(); got != 3 {
+				t.Fatalf("committed up to %d, want 3", got)
+			}
+		})
+	}
+}
+
+func TestReconcilePolicies(t *testing.T) {
+	inconsistent := testOrder("a")
+	inconsistent.Payment.Amount = 1000
+	// flags are the consumer's to set, not the producer's
+	inconsistent.Flags = []models.Flag{{Field: "payment.bank", Message: "sent by the producer"}}
+	consistent := testOrder("b")
+	consistent.Flags = inconsistent.Flags
+
+	for _, tt := range []struct {
+		policy   string
+		stored   bool
+		flags    []string
+		rejected []string
+	}{
+		{validation.ReconcileReject, false, nil, []string{reasonInconsistentOrder}},
+		{validation.ReconcileFlag, true, []string{"payment.amount"}, nil},
+		{validation.ReconcileIgnore, true, nil, nil},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			r := newFakeReader(testPayload(t, inconsistent), testPayload(t, consistent))
+			s := newFakeStore()
+			c := newTestConsumer(r, s, BadMessageDLQ)
+			c.reconcile = tt.policy
+
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			o, ok := s.orders["a"]
+			if ok != tt.stored {
+				t.Fatalf("stored %v, want %v", ok, tt.stored)
+			}
+			var flags []string
+			for _, f := range o.Flags {
+				flags = append(flags, f.Field)
+			}
+			if !slices.Equal(flags, tt.flags) {
+				t.Fatalf("flags %v, want %v", flags, tt.flags)
+			}
+			if b := s.orders["b"]; b.OrderUID == "" || b.Flags != nil {
+				t.Fatalf("consistent order stored as %+v", b)
+			}
+			var reasons []string
+			for _, m := range s.rejected {
+				reasons = append(reasons, m.Reason)
+			}
+			if !slices.Equal(reasons, tt.rejected) {
+				t.Fatalf("rejected with %v, want %v", reasons, tt.rejected)
+			}
+			if got := r.lastCommitted(); got != 1 {
+				t.Fatalf("committed up to %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestDecodeReasons(t *testing.T) {
+	c := newTestConsumer(newFakeReader(), newFakeStore(), BadMessageDLQ)
+	invalid := testOrder("a")
+	invalid.Items = nil
+	for _, tt := range []struct {
+		contentType string
+		value       string
+		reason      string
+	}{
+		{"", `{"order_uid": `, reasonBadJSON},
+		{"Application/JSON; charset=UTF-8", `{"order_uid": `, reasonBadJSON},
+		{"application/x-protobuf", `{"order_uid": `, reasonBadPayload},
+		{"text/plain", `{"order_uid": `, reasonUnsupportedContentType},
+		{"", `{"schema_version":1,"event_type":"order.created","payload":{"order_uid":1}}`, reasonBadJSON},
+		{"", `{"schema_version":1,"event_type":"order.created","payload":{"gift_wrap":true}}`, reasonUnknownField},
+		{"", `{"schema_version":2,"event_type":"order.created","payload":{}}`, reasonUnsupportedVersion},
+		{"", `{"schema_version":1,"event_type":"order.deleted","payload":{}}`, reasonBadEnvelope},
+		{"", string(testPayload(t, invalid)), reasonInvalidOrder},
+	} {
+		_, err := c.decodeOrder(context.Background(), tt.contentType, []byte(tt.value))
+		var re *RejectError
+		if !errors.As(err, &re) || re.Reason != tt.reason {
+			t.Errorf("%q %s: %v, want a %s rejection", tt.contentType, tt.value, err, tt.reason)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/config"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	reasonBadJSON                = "bad_json"
+	reasonBadPayload             = "bad_payload"
+	reasonUnsupportedContentType = "unsupported_content_type"
+	reasonBadEnvelope            = "bad_envelope"
+	reasonUnsupportedVersion     = "unsupported_version"
+	reasonUnknownField           = "unknown_field"
+	reasonInvalidOrder           = "invalid_order"
+	reasonInconsistentOrder      = "inconsistent_order"
+	reasonPermanentDBError       = "permanent_db_error"
+	reasonRetriesExhausted       = "retries_exhausted"
+
+	dlqRetryDelay = time.Second
+)
+
+const (
+	headerError             = "x-error"
+	headerReason            = "x-error-reason"
+	headerOriginalTopic     = "x-original-topic"
+	headerOriginalPartition = "x-original-partition"
+	headerOriginalOffset    = "x-original-offset"
+	headerOriginalTime      = "x-original-timestamp"
+	headerFailedAt          = "x-failed-at"
+)
+
+// deadLetters republishes messages the consumer cannot process, keeping the
+// original key, value and headers and describing the failure in extra headers.
+// Without a configured topic it is disabled and messages are only logged.
+type deadLetters struct {
+	writer messageWriter
+	topic  string
+}
+
+// messageWriter is the part of *kafka.Writer dead-lettering uses.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+func newDeadLetters(cfg config.Config) *deadLetters {
+	if cfg.KafkaDLQTopic == "" {
+		return &deadLetters{}
+	}
+	return &deadLetters{topic: cfg.KafkaDLQTopic, writer: &kafka.Writer{
+		Addr:         kafka.TCP(cfg.KafkaBrokers...),
+		Topic:        cfg.KafkaDLQTopic,
+		RequiredAcks: kafka.RequireAll,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: 10 * time.Millisecond,
+	}}
+}
+
+// publish blocks until the message is written or ctx is cancelled, so the caller
+// never commits an offset whose message was lost.
+func (d *deadLetters) publish(ctx context.Context, m kafka.Message, reason string, cause error) error {
+	if d.writer == nil {
+		log.Warn().Str("reason", reason).Int("partition", m.Partition).Int64("offset", m.Offset).
+			Msg("No dead-letter topic configured, dropping message")
+		return nil
+	}
+	headers := append([]kafka.Header{}, m.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: headerError, Value: []byte(cause.Error())},
+		kafka.Header{Key: headerReason, Value: []byte(reason)},
+		kafka.Header{Key: headerOriginalTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: headerOriginalPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: headerOriginalOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafka.Header{Key: headerOriginalTime, Value: []byte(m.Time.UTC().Format(time.RFC3339Nano))},
+		kafka.Header{Key: headerFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+	)
+	dl := kafka.Message{Key: m.Key, Value: m.Value, Headers: headers}
+
+	for {
+		err := d.writer.WriteMessages(ctx, dl)
+		if err == nil {
+			log.Info().Str("reason", reason).Str("topic", d.topic).Int("partition", m.Partition).
+				Int64("offset", m.Offset).Msg("Sent message to dead-letter topic")
+			return nil
+		}
+		log.Error().Err(err).Str("topic", d.topic).Msg("Failed to write dead letter, retrying")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(dlqRetryDelay):
+		}
+	}
+}
+
+func (d *deadLetters) Close() {
+	if d.writer != nil {
+		_ = d.writer.Close()
+	}
+}
@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type fakeWriter struct {
+	mu   sync.Mutex
+	err  error
+	msgs []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+func header(m kafka.Message, key string) (string, bool) {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value), true
+		}
+	}
+	return "", false
+}
+
+func TestDeadLetterHeaders(t *testing.T) {
+	w := &fakeWriter{}
+	r := newFakeReader([]byte("not json"))
+	r.msgs[0].Partition = 3
+	r.msgs[0].Offset = 42
+	r.msgs[0].Key = []byte("key-1")
+	r.msgs[0].Time = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	r.msgs[0].Headers = []kafka.Header{{Key: "trace-id", Value: []byte("t-1")}}
+	s := newFakeStore()
+	c := newTestConsumer(r, s, BadMessageDLQ)
+	c.dlq = &deadLetters{writer: w, topic: "orders-dlq"}
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.msgs) != 1 {
+		t.Fatalf("wrote %d dead letters, want 1", len(w.msgs))
+	}
+	dl := w.msgs[0]
+	if string(dl.Key) != "key-1" || string(dl.Value) != "not json" {
+		t.Fatalf("dead letter key %q value %q", dl.Key, dl.Value)
+	}
+	for key, want := range map[string]string{
+		"trace-id":              "t-1",
+		headerReason:            reasonBadJSON,
+		headerOriginalTopic:     "orders",
+		headerOriginalPartition: "3",
+		headerOriginalOffset:    "42",
+		headerOriginalTime:      "2024-01-02T03:04:05Z",
+	} {
+		if got, ok := header(dl, key); !ok || got != want {
+			t.Errorf("header %s = %q, want %q", key, got, want)
+		}
+	}
+	if got, _ := header(dl, headerError); got == "" {
+		t.Error("no error header")
+	}
+	if got, _ := header(dl, headerFailedAt); got == "" {
+		t.Error("no failed-at header")
+	}
+	if len(s.rejected) != 1 || s.rejected[0].Reason != reasonBadJSON || s.rejected[0].Offset != 42 {
+		t.Fatalf("quarantined %+v", s.rejected)
+	}
+	if got := r.lastCommitted(); got != 42 {
+		t.Fatalf("committed up to %d, want 42", got)
+	}
+}
+
+// A dead letter that cannot be written must not let the offset be committed.
+func TestDeadLetterWriteFailureBlocksCommit(t *testing.T) {
+	w := &fakeWriter{err: errors.New("broker down")}
+	r := newFakeReader([]byte("not json"))
+	c := newTestConsumer(r, newFakeStore(), BadMessageDLQ)
+	c.dlq = &deadLetters{writer: w, topic: "orders-dlq"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := c.processOne(ctx, r.msgs[0])
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("processOne: %v, want the context error", err)
+	}
+	if got := r.lastCommitted(); got != -1 {
+		t.Fatalf("committed offset %d after a failed dead letter", got)
+	}
+}
+
+func TestDeadLettersDisabled(t *testing.T) {
+	d := &deadLetters{}
+	if err := d.publish(context.Background(), kafka.Message{}, reasonBadJSON, errors.New("x")); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+}
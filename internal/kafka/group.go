@@ -0,0 +1,206 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	partitionMinBackoff = time.Second
+	partitionMaxBackoff = 30 * time.Second
+)
+
+// groupReader joins the consumer group only for partition assignment and reads
+// each assigned partition from the offset stored in Postgres, falling back to
+// the group offset for partitions the database has not seen yet.
+type groupReader struct {
+	cfg     kafka.ReaderConfig
+	group   *kafka.ConsumerGroup
+	offsets func(ctx context.Context) (map[int]int64, error)
+	open    func(partition int) partitionReader
+	msgs    chan kafka.Message
+
+	startOnce sync.Once
+	ctx       context.Context
+	stop      context.CancelFunc
+
+	mu  sync.Mutex
+	gen *kafka.Generation
+}
+
+func newGroupReader(cfg kafka.ReaderConfig, offsets func(ctx context.Context) (map[int]int64, error)) (*groupReader, error) {
+	group, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:      cfg.GroupID,
+		Brokers: cfg.Brokers,
+		Topics:  []string{cfg.Topic},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	g := &groupReader{
+		cfg:     cfg,
+		group:   group,
+		offsets: offsets,
+		msgs:    make(chan kafka.Message),
+		ctx:     ctx,
+		stop:    stop,
+	}
+	g.open = g.openPartition
+	return g, nil
+}
+
+// partitionReader is the part of *kafka.Reader that readFrom needs.
+type partitionReader interface {
+	SetOffset(offset int64) error
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	Close() error
+}
+
+func (g *groupReader) openPartition(partition int) partitionReader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   g.cfg.Brokers,
+		Topic:     g.cfg.Topic,
+		Partition: partition,
+		MinBytes:  g.cfg.MinBytes,
+		MaxBytes:  g.cfg.MaxBytes,
+		MaxWait:   g.cfg.MaxWait,
+	})
+}
+
+func (g *groupReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	g.startOnce.Do(func() { go g.run() })
+	select {
+	case m := <-g.msgs:
+		return m, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	case <-g.ctx.Done():
+		return kafka.Message{}, io.EOF
+	}
+}
+
+func (g *groupReader) run() {
+	for {
+		gen, err := g.group.Next(g.ctx)
+		if err != nil {
+			if errors.Is(err, kafka.ErrGroupClosed) || g.ctx.Err() != nil {
+				return
+			}
+			log.Error().Err(err).Msg("Failed to join consumer group")
+			select {
+			case <-g.ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		stored, err := g.offsets(g.ctx)
+		if err != nil {
+			// the transactional offset check still rejects anything applied twice
+			log.Error().Err(err).Msg("Failed to load stored offsets, using group offsets")
+		}
+		g.mu.Lock()
+		g.gen = gen
+		g.mu.Unlock()
+		for _, a := range gen.Assignments[g.cfg.Topic] {
+			start := startOffset(a, stored)
+			log.Info().Int32("generation", gen.ID).Int("partition", a.ID).Int64("offset", start).
+				Msg("Partition assigned")
+			partition := a.ID
+			gen.Start(func(ctx context.Context) { g.readPartition(ctx, partition, start) })
+		}
+	}
+}
+
+// startOffset is where an assigned partition is read from: right after the
+// offset stored in Postgres, or the group offset if none is stored.
+func startOffset(a kafka.PartitionAssignment, stored map[int]int64) int64 {
+	if o, ok := stored[a.ID]; ok {
+		return o + 1
+	}
+	return a.Offset
+}
+
+// readPartition reads until the generation ends. Read errors reopen the
+// partition after the last message handed out, so it never silently stops.
+func (g *groupReader) readPartition(ctx context.Context, partition int, offset int64) {
+	backoff := partitionMinBackoff
+	for {
+		read, err := g.readFrom(ctx, partition, &offset)
+		if ctx.Err() != nil {
+			return
+		}
+		if read {
+			backoff = partitionMinBackoff
+		}
+		log.Error().Err(err).Int("partition", partition).Int64("offset", offset).Dur("retry_in", backoff).
+			Msg("Failed to read partition, will retry")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, partitionMaxBackoff)
+	}
+}
+
+// readFrom reads partition from *offset, moving *offset past every message
+// handed out, and reports whether there were any.
+func (g *groupReader) readFrom(ctx context.Context, partition int, offset *int64) (bool, error) {
+	r := g.open(partition)
+	defer r.Close()
+	if err := r.SetOffset(*offset); err != nil {
+		return false, fmt.Errorf("seek: %w", err)
+	}
+	read := false
+	for {
+		m, err := r.FetchMessage(ctx)
+		if err != nil {
+			return read, err
+		}
+		select {
+		case g.msgs <- m:
+			*offset = m.Offset + 1
+			read = true
+		case <-ctx.Done():
+			return read, ctx.Err()
+		}
+	}
+}
+
+// CommitMessages mirrors processed offsets to the group so lag monitoring keeps
+// working; the offsets in Postgres are the ones that count.
+func (g *groupReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	g.mu.Lock()
+	gen := g.gen
+	g.mu.Unlock()
+	if gen == nil || len(msgs) == 0 {
+		return nil
+	}
+	offsets := make(map[string]map[int]int64, 1)
+	for _, m := range msgs {
+		if offsets[m.Topic] == nil {
+			offsets[m.Topic] = make(map[int]int64)
+		}
+		if m.Offset+1 > offsets[m.Topic][m.Partition] {
+			offsets[m.Topic][m.Partition] = m.Offset + 1
+		}
+	}
+	return gen.CommitOffsets(offsets)
+}
+
+func (g *groupReader) Config() kafka.ReaderConfig { return g.cfg }
+
+func (g *groupReader) Close() error {
+	g.stop()
+	return g.group.Close()
+}
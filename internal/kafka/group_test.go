@@ -0,0 +1,93 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakePartition serves log from the offset it was last seeked to and fails once
+// it runs out, like a partition whose broker went away.
+type fakePartition struct {
+	log   []kafka.Message
+	pos   int64
+	seeks *[]int64
+}
+
+func (p *fakePartition) SetOffset(offset int64) error {
+	*p.seeks = append(*p.seeks, offset)
+	p.pos = offset
+	return nil
+}
+
+func (p *fakePartition) FetchMessage(context.Context) (kafka.Message, error) {
+	if p.pos >= int64(len(p.log)) {
+		return kafka.Message{}, errors.New("broker not available")
+	}
+	p.pos++
+	return p.log[p.pos-1], nil
+}
+
+func (p *fakePartition) Close() error { return nil }
+
+func TestStartOffset(t *testing.T) {
+	stored := map[int]int64{0: 41}
+	for _, tt := range []struct {
+		a    kafka.PartitionAssignment
+		want int64
+	}{
+		{kafka.PartitionAssignment{ID: 0, Offset: 10}, 42},
+		{kafka.PartitionAssignment{ID: 1, Offset: 10}, 10},
+		{kafka.PartitionAssignment{ID: 1, Offset: kafka.FirstOffset}, kafka.FirstOffset},
+	} {
+		if got := startOffset(tt.a, stored); got != tt.want {
+			t.Fatalf("partition %d: starts at %d, want %d", tt.a.ID, got, tt.want)
+		}
+	}
+}
+
+func TestReadFromResumes(t *testing.T) {
+	var partitionLog []kafka.Message
+	for i := range 7 {
+		partitionLog = append(partitionLog, kafka.Message{Partition: 3, Offset: int64(i)})
+	}
+	var seeks []int64
+	g := &groupReader{
+		msgs: make(chan kafka.Message),
+		open: func(int) partitionReader { return &fakePartition{log: partitionLog, seeks: &seeks} },
+	}
+	var got []int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for m := range g.msgs {
+			got = append(got, m.Offset)
+		}
+	}()
+
+	// offset 4 is stored in Postgres
+	offset := startOffset(kafka.PartitionAssignment{ID: 3}, map[int]int64{3: 4})
+	read, err := g.readFrom(context.Background(), 3, &offset)
+	if !read || err == nil {
+		t.Fatalf("readFrom: %v, %v", read, err)
+	}
+	if offset != 7 {
+		t.Fatalf("offset %d after the last message, want 7", offset)
+	}
+	// a reopened partition continues after the last message handed out
+	if read, _ := g.readFrom(context.Background(), 3, &offset); read {
+		t.Fatal("read past the end of the partition")
+	}
+	close(g.msgs)
+	<-done
+
+	if !slices.Equal(got, []int64{5, 6}) {
+		t.Fatalf("read offsets %v, want [5 6]", got)
+	}
+	if !slices.Equal(seeks, []int64{5, 7}) {
+		t.Fatalf("seeked to %v, want [5 7]", seeks)
+	}
+}
@@ -0,0 +1,199 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/rs/zerolog/log"
+)
+
+// runWorkers fetches on one goroutine and hands messages to c.workers workers.
+// A partition (or, in key mode, a message key) always lands on the same worker,
+// so orders keep their relative order. When ctx is cancelled fetching stops and
+// the workers finish what they were already given, for at most drainTimeout.
+func (c *Consumer) runWorkers(ctx context.Context) error {
+	c.offsets = newOffsetTracker()
+	defer func() { c.offsets = nil }()
+
+	fetchCtx, stopFetch := context.WithCancel(ctx)
+	defer stopFetch()
+	workCtx, stopWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopWork()
+
+	var (
+		wg       sync.WaitGroup
+		failOnce sync.Once
+		failErr  error
+	)
+	queues := make([]chan kafka.Message, c.workers)
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, max(c.batchSize, 1))
+		wg.Add(1)
+		go func(q <-chan kafka.Message) {
+			defer wg.Done()
+			if err := c.work(workCtx, q); err != nil {
+				failOnce.Do(func() {
+					failErr = err
+					stopFetch()
+				})
+			}
+		}(queues[i])
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		select {
+		case <-drained:
+			return
+		case <-ctx.Done():
+		}
+		select {
+		case <-drained:
+		case <-time.After(c.drainTimeout):
+			log.Warn().Dur("timeout", c.drainTimeout).Msg("Workers did not drain in time")
+			stopWork()
+		}
+	}()
+
+	var fetchErr error
+fetch:
+	for {
+		m, err := c.reader.FetchMessage(fetchCtx)
+		if err != nil {
+			if fetchCtx.Err() == nil {
+				log.Error().Err(err).Msg("Failed to read message")
+				fetchErr = err
+			}
+			break
+		}
+		c.offsets.fetched(m)
+		select {
+		case queues[c.route(m)] <- m:
+		case <-fetchCtx.Done():
+			break fetch
+		}
+	}
+
+	for _, q := range queues {
+		close(q)
+	}
+	wg.Wait()
+	close(drained)
+	log.Info().Msg("Kafka workers drained")
+
+	if failErr != nil && !errors.Is(failErr, context.Canceled) {
+		return failErr
+	}
+	return fetchErr
+}
+
+func (c *Consumer) route(m kafka.Message) int {
+	if c.dispatch == DispatchKey && len(m.Key) > 0 {
+		h := fnv.New32a()
+		h.Write(m.Key)
+		return int(h.Sum32() % uint32(c.workers))
+	}
+	return m.Partition % c.workers
+}
+
+// work processes the queue until it is closed, batching like fetchBatch does.
+func (c *Consumer) work(ctx context.Context, q <-chan kafka.Message) error {
+	for m := range q {
+		if c.batchSize <= 1 {
+			if err := c.processOne(ctx, m); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.processBatch(ctx, c.collect(q, m)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Consumer) collect(q <-chan kafka.Message, first kafka.Message) []kafka.Message {
+	msgs := make([]kafka.Message, 1, c.batchSize)
+	msgs[0] = first
+	timer := time.NewTimer(c.batchWait)
+	defer timer.Stop()
+	for len(msgs) < c.batchSize {
+		select {
+		case m, ok := <-q:
+			if !ok {
+				return msgs
+			}
+			msgs = append(msgs, m)
+		case <-timer.C:
+			return msgs
+		}
+	}
+	return msgs
+}
+
+// offsetTracker remembers the fetch order of every partition so that a message
+// finished early by one worker is not committed before the earlier messages
+// other workers still hold. After a rebalance the reader may deliver an offset
+// again, so completions are counted per offset rather than just marked, and
+// nothing at or below an already committed offset is committed again.
+type offsetTracker struct {
+	mu        sync.Mutex
+	pending   map[int][]kafka.Message // fetched, not yet committed messages, in fetch order
+	done      map[int]map[int64]int   // completions not yet matched against pending
+	committed map[int]int64
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		pending:   make(map[int][]kafka.Message),
+		done:      make(map[int]map[int64]int),
+		committed: make(map[int]int64),
+	}
+}
+
+func (t *offsetTracker) fetched(m kafka.Message) {
+	t.mu.Lock()
+	t.pending[m.Partition] = append(t.pending[m.Partition], m)
+	t.mu.Unlock()
+}
+
+// complete marks msgs as processed and returns, per partition, the last message
+// of the processed prefix, i.e. what can be committed now. t.mu must be held.
+func (t *offsetTracker) complete(msgs []kafka.Message) []kafka.Message {
+	touched := make(map[int]struct{}, 1)
+	for _, m := range msgs {
+		if t.done[m.Partition] == nil {
+			t.done[m.Partition] = make(map[int64]int)
+		}
+		t.done[m.Partition][m.Offset]++
+		touched[m.Partition] = struct{}{}
+	}
+
+	var out []kafka.Message
+	for p := range touched {
+		pending, done := t.pending[p], t.done[p]
+		n := 0
+		for n < len(pending) && done[pending[n].Offset] > 0 {
+			if done[pending[n].Offset]--; done[pending[n].Offset] == 0 {
+				delete(done, pending[n].Offset)
+			}
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		last := pending[n-1]
+		t.pending[p] = pending[n:]
+		if c, ok := t.committed[p]; ok && last.Offset <= c {
+			continue
+		}
+		t.committed[p] = last.Offset
+		out = append(out, last)
+	}
+	return out
+}
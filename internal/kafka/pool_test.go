@@ -0,0 +1,143 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// eventually polls cond until it holds or a second has passed.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// completeOffsets feeds the given offsets of partition p to t.complete and
+// returns the committable offsets.
+func completeOffsets(t *offsetTracker, p int, offsets ...int64) []int64 {
+	msgs := make([]kafka.Message, len(offsets))
+	for i, o := range offsets {
+		msgs[i] = kafka.Message{Partition: p, Offset: o}
+	}
+	var out []int64
+	for _, m := range t.complete(msgs) {
+		out = append(out, m.Offset)
+	}
+	return out
+}
+
+func fetchOffsets(t *offsetTracker, p int, offsets ...int64) {
+	for _, o := range offsets {
+		t.fetched(kafka.Message{Partition: p, Offset: o})
+	}
+}
+
+func TestOffsetTrackerOutOfOrder(t *testing.T) {
+	tr := newOffsetTracker()
+	fetchOffsets(tr, 0, 0, 1, 2, 3)
+	fetchOffsets(tr, 1, 0, 1)
+
+	if got := completeOffsets(tr, 0, 2); got != nil {
+		t.Fatalf("committed %v past the unfinished offset 0", got)
+	}
+	if got := completeOffsets(tr, 1, 0); !slices.Equal(got, []int64{0}) {
+		t.Fatalf("partition 1: committed %v, want [0]", got)
+	}
+	if got := completeOffsets(tr, 0, 0); !slices.Equal(got, []int64{0}) {
+		t.Fatalf("committed %v, want [0]", got)
+	}
+	if got := completeOffsets(tr, 0, 3, 1); !slices.Equal(got, []int64{3}) {
+		t.Fatalf("committed %v, want [3]", got)
+	}
+	if len(tr.pending[0]) != 0 || len(tr.done[0]) != 0 {
+		t.Fatalf("left pending %v, done %v", tr.pending[0], tr.done[0])
+	}
+}
+
+func TestOffsetTrackerDuplicates(t *testing.T) {
+	tr := newOffsetTracker()
+	// 5 and 6 are delivered again after a rebalance, before the first copies finish
+	fetchOffsets(tr, 0, 4, 5, 6, 5, 6)
+
+	if got := completeOffsets(tr, 0, 5, 5); got != nil {
+		t.Fatalf("committed %v past the unfinished offset 4", got)
+	}
+	if got := completeOffsets(tr, 0, 4); !slices.Equal(got, []int64{5}) {
+		t.Fatalf("committed %v, want [5]", got)
+	}
+	// the prefix now ends at the second 5, which was committed already
+	if got := completeOffsets(tr, 0, 6); got != nil {
+		t.Fatalf("committed %v again", got)
+	}
+	if got := completeOffsets(tr, 0, 6); !slices.Equal(got, []int64{6}) {
+		t.Fatalf("committed %v, want [6]", got)
+	}
+	if len(tr.pending[0]) != 0 || len(tr.done[0]) != 0 {
+		t.Fatalf("left pending %v, done %v", tr.pending[0], tr.done[0])
+	}
+
+	// a replay of an already committed offset never moves the commit back
+	fetchOffsets(tr, 0, 3)
+	if got := completeOffsets(tr, 0, 3); got != nil {
+		t.Fatalf("committed %v below the last commit", got)
+	}
+	if len(tr.pending[0]) != 0 {
+		t.Fatalf("left pending %v", tr.pending[0])
+	}
+}
+
+func TestRunWorkersDrainsOnShutdown(t *testing.T) {
+	const perPartition = 10
+	r := &fakeReader{block: true}
+	for i := range 2 * perPartition {
+		r.msgs = append(r.msgs, kafka.Message{
+			Topic: "orders", Partition: i % 2, Offset: int64(i / 2),
+			Value: testPayload(t, testOrder(fmt.Sprintf("order-%d", i))),
+		})
+	}
+	s := newFakeStore()
+	s.latency = 2 * time.Millisecond
+	c := newTestConsumer(r, s, BadMessageDLQ)
+	c.workers = 2
+	c.drainTimeout = 5 * time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+	// workers are still busy with what they were handed when fetching stops
+	eventually(t, "all messages fetched", func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.next == len(r.msgs)
+	})
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if len(s.orders) != 2*perPartition {
+		t.Fatalf("saved %d orders, want %d", len(s.orders), 2*perPartition)
+	}
+	last := map[int]int64{0: -1, 1: -1}
+	for _, m := range r.committed {
+		if m.Offset <= last[m.Partition] {
+			t.Fatalf("partition %d: committed %d after %d", m.Partition, m.Offset, last[m.Partition])
+		}
+		last[m.Partition] = m.Offset
+	}
+	for p, o := range last {
+		if o != perPartition-1 {
+			t.Fatalf("partition %d: committed up to %d, want %d", p, o, perPartition-1)
+		}
+	}
+}
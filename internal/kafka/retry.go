@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+	"github.com/ratmirtech/techwb-l0/internal/repo"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/rs/zerolog/log"
+)
+
+type retryPolicy struct {
+	maxAttempts int // 0 retries forever
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// delay is exponential in attempt with full jitter, so consumers of many
+// partitions do not hit a recovering database in lockstep.
+func (p retryPolicy) delay(attempt int) time.Duration {
+	// doubling stops at maxDelay, so large base delays or attempts cannot overflow
+	d := p.baseDelay
+	for i := 1; i < attempt && d > 0 && d < p.maxDelay; i++ {
+		d = min(d, p.maxDelay/2) * 2
+	}
+	d = min(d, p.maxDelay)
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(d))) + 1
+}
+
+// upsert saves order, retrying transient failures. Connection failures are
+// retried until the database is back, so an outage stalls the partition
+// instead of dead-lettering everything in it. Permanent failures and other
+// errors that run out of attempts come back as a *RejectError for the
+// dead-letter path and a replayed message as repo.ErrAlreadyApplied; any other
+// error means ctx was cancelled.
+func (c *Consumer) upsert(ctx context.Context, order models.Order, m kafka.Message) error {
+	return c.retrying(ctx, order.OrderUID, func() error {
+		if c.exactlyOnce {
+			return c.repo.UpsertOrdersAt(ctx, c.group, []models.Order{order}, positions([]kafka.Message{m}))
+		}
+		return c.repo.UpsertOrder(ctx, order)
+	})
+}
+
+// upsertBatch saves orders and, with exactly-once on, the offsets of all of msgs.
+func (c *Consumer) upsertBatch(ctx context.Context, orders []models.Order, msgs []kafka.Message) error {
+	return c.retrying(ctx, fmt.Sprintf("batch of %d", len(orders)), func() error {
+		if c.exactlyOnce {
+			return c.repo.UpsertOrdersAt(ctx, c.group, orders, batchPositions(msgs))
+		}
+		return c.repo.UpsertOrders(ctx, orders)
+	})
+}
+
+func (c *Consumer) retrying(ctx context.Context, what string, save func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := save()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, repo.ErrAlreadyApplied) {
+			return err
+		}
+		if repo.IsPermanent(err) {
+			return &RejectError{Reason: reasonPermanentDBError, Err: err}
+		}
+		if c.retry.maxAttempts > 0 && attempt >= c.retry.maxAttempts && !repo.IsConnection(err) {
+			return &RejectError{Reason: reasonRetriesExhausted, Err: err}
+		}
+		d := c.retry.delay(attempt)
+		log.Error().Err(err).Str("orders", what).Int("attempt", attempt).Dur("retry_in", d).
+			Msg("Failed to save to DB, will retry")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package kafka
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRetryDelayBounds(t *testing.T) {
+	tests := []struct {
+		policy  retryPolicy
+		attempt int
+		max     time.Duration
+	}{
+		{retryPolicy{baseDelay: 100 * time.Millisecond, maxDelay: 10 * time.Second}, 1, 100 * time.Millisecond},
+		{retryPolicy{baseDelay: 100 * time.Millisecond, maxDelay: 10 * time.Second}, 4, 800 * time.Millisecond},
+		{retryPolicy{baseDelay: 100 * time.Millisecond, maxDelay: 10 * time.Second}, 1000, 10 * time.Second},
+		// base<<shift would overflow int64 here
+		{retryPolicy{baseDelay: time.Hour, maxDelay: 24 * time.Hour}, 30, 24 * time.Hour},
+		{retryPolicy{baseDelay: math.MaxInt64 / 2, maxDelay: math.MaxInt64}, 3, math.MaxInt64},
+		{retryPolicy{baseDelay: time.Minute, maxDelay: time.Second}, 1, time.Second},
+	}
+	for _, tt := range tests {
+		for range 100 {
+			d := tt.policy.delay(tt.attempt)
+			if d <= 0 || d > tt.max {
+				t.Fatalf("%+v attempt %d: delay %v, want in (0, %v]", tt.policy, tt.attempt, d, tt.max)
+			}
+		}
+	}
+	if d := (retryPolicy{}).delay(5); d != 0 {
+		t.Fatalf("zero policy: delay %v", d)
+	}
+}
@@ -0,0 +1,7 @@
+package models
+
+// Flag is a consistency problem an order was accepted with, kept for review.
+type Flag struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
@@ -19,4 +19,5 @@ type Order struct {
 	SmID              int       `json:"sm_id"`
 	DateCreated       time.Time `json:"date_created"`
 	OofShard          string    `json:"oof_shard"`
+	Flags             []Flag    `json:"flags,omitempty"`
 }
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type RejectedMessage struct {
+	ID            int64      `json:"id"`
+	Topic         string     `json:"topic"`
+	Partition     int        `json:"partition"`
+	Offset        int64      `json:"offset"`
+	Key           string     `json:"key"`
+	ContentType   string     `json:"content_type,omitempty"`
+	Payload       []byte     `json:"payload"` // base64 in JSON, it may be Protobuf or Avro
+	Reason        string     `json:"reason"`
+	Error         string     `json:"error"`
+	ReceivedAt    time.Time  `json:"received_at"`
+	ResubmittedAt *time.Time `json:"resubmitted_at,omitempty"`
+	ResubmitError *string    `json:"resubmit_error,omitempty"`
+}
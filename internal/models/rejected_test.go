@@ -0,0 +1,23 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestRejectedPayloadSurvivesJSON(t *testing.T) {
+	// an Avro wire format header is not valid UTF-8
+	in := RejectedMessage{Payload: []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0xff, 0xfe}}
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out RejectedMessage
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Payload, in.Payload) {
+		t.Fatalf("payload %x after a JSON round trip, want %x", out.Payload, in.Payload)
+	}
+}
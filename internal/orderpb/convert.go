@@ -0,0 +1,122 @@
+package orderpb
+
+import (
+	"github.com/ratmirtech/techwb-l0/internal/models"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//go:generate sh -c "cd ../../proto && buf generate"
+
+func FromModel(o models.Order) *Order {
+	d, p := o.Delivery, o.Payment
+	out := &Order{
+		OrderUid:    o.OrderUID,
+		TrackNumber: o.TrackNumber,
+		Entry:       o.Entry,
+		Delivery: &Delivery{
+			Name:    d.Name,
+			Phone:   d.Phone,
+			Zip:     d.Zip,
+			City:    d.City,
+			Address: d.Address,
+			Region:  d.Region,
+			Email:   d.Email,
+		},
+		Payment: &Payment{
+			Transaction:  p.Transaction,
+			RequestId:    p.RequestID,
+			Currency:     p.Currency,
+			Provider:     p.Provider,
+			Amount:       int64(p.Amount),
+			PaymentDt:    p.PaymentDt,
+			Bank:         p.Bank,
+			DeliveryCost: int64(p.DeliveryCost),
+			GoodsTotal:   int64(p.GoodsTotal),
+			CustomFee:    int64(p.CustomFee),
+		},
+		Locale:            o.Locale,
+		InternalSignature: o.InternalSignature,
+		CustomerId:        o.CustomerID,
+		DeliveryService:   o.DeliveryService,
+		Shardkey:          o.Shardkey,
+		SmId:              int64(o.SmID),
+		OofShard:          o.OofShard,
+	}
+	if !o.DateCreated.IsZero() {
+		out.DateCreated = timestamppb.New(o.DateCreated)
+	}
+	for _, it := range o.Items {
+		out.Items = append(out.Items, &Item{
+			ChrtId:      int64(it.ChrtID),
+			TrackNumber: it.TrackNumber,
+			Price:       int64(it.Price),
+			Rid:         it.RID,
+			Name:        it.Name,
+			Sale:        int64(it.Sale),
+			Size:        it.Size,
+			TotalPrice:  int64(it.TotalPrice),
+			NmId:        int64(it.NmID),
+			Brand:       it.Brand,
+			Status:      int64(it.Status),
+		})
+	}
+	return out
+}
+
+// ToModel is the inverse of FromModel; missing messages become zero values.
+func ToModel(x *Order) models.Order {
+	d, p := x.GetDelivery(), x.GetPayment()
+	o := models.Order{
+		OrderUID:    x.GetOrderUid(),
+		TrackNumber: x.GetTrackNumber(),
+		Entry:       x.GetEntry(),
+		Delivery: models.Delivery{
+			Name:    d.GetName(),
+			Phone:   d.GetPhone(),
+			Zip:     d.GetZip(),
+			City:    d.GetCity(),
+			Address: d.GetAddress(),
+			Region:  d.GetRegion(),
+			Email:   d.GetEmail(),
+		},
+		Payment: models.Payment{
+			Transaction:  p.GetTransaction(),
+			RequestID:    p.GetRequestId(),
+			Currency:     p.GetCurrency(),
+			Provider:     p.GetProvider(),
+			Amount:       int(p.GetAmount()),
+			PaymentDt:    p.GetPaymentDt(),
+			Bank:         p.GetBank(),
+			DeliveryCost: int(p.GetDeliveryCost()),
+			GoodsTotal:   int(p.GetGoodsTotal()),
+			CustomFee:    int(p.GetCustomFee()),
+		},
+		Locale:            x.GetLocale(),
+		InternalSignature: x.GetInternalSignature(),
+		CustomerID:        x.GetCustomerId(),
+		DeliveryService:   x.GetDeliveryService(),
+		Shardkey:          x.GetShardkey(),
+		SmID:              int(x.GetSmId()),
+		OofShard:          x.GetOofShard(),
+	}
+	if x.GetDateCreated() != nil {
+		o.DateCreated = x.GetDateCreated().AsTime()
+	}
+	for _, it := range x.GetItems() {
+		o.Items = append(o.Items, models.Item{
+			ChrtID:      int(it.GetChrtId()),
+			TrackNumber: it.GetTrackNumber(),
+			Price:       int(it.GetPrice()),
+			RID:         it.GetRid(),
+			Name:        it.GetName(),
+			Sale:        int(it.GetSale()),
+			Size:        it.GetSize(),
+			TotalPrice:  int(it.GetTotalPrice()),
+			NmID:        int(it.GetNmId()),
+			Brand:       it.GetBrand(),
+			Status:      int(it.GetStatus()),
+		})
+	}
+	return o
+}
@@ -0,0 +1,91 @@
+package orderpb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func testOrder() models.Order {
+	return models.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: models.Delivery{Name: "Test Testov", Phone: "+9720000000", Zip: "2639809",
+			City: "Kiryat Mozkin", Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com"},
+		Payment: models.Payment{Transaction: "b563feb7b2b84b6test", RequestID: "req", Currency: "USD", Provider: "wbpay",
+			Amount: 1817, PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317, CustomFee: 5},
+		Items: []models.Item{
+			{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, RID: "ab4219087a764ae0btest",
+				Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202},
+			{ChrtID: 1, Name: "Brush"},
+		},
+		Locale:            "en",
+		InternalSignature: "sig",
+		CustomerID:        "test",
+		DeliveryService:   "meest",
+		Shardkey:          "9",
+		SmID:              99,
+		DateCreated:       time.Date(2021, 11, 26, 6, 22, 19, 123456789, time.UTC),
+		OofShard:          "1",
+	}
+}
+
+// roundTrip sends o through the Protobuf wire format.
+func roundTrip(t *testing.T, o models.Order) models.Order {
+	t.Helper()
+	b, err := proto.Marshal(FromModel(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var x Order
+	if err := proto.Unmarshal(b, &x); err != nil {
+		t.Fatal(err)
+	}
+	return ToModel(&x)
+}
+
+func TestRoundTrip(t *testing.T) {
+	if got := roundTrip(t, testOrder()); !reflect.DeepEqual(got, testOrder()) {
+		t.Fatalf("got %+v\nwant %+v", got, testOrder())
+	}
+}
+
+func TestRoundTripZeroValues(t *testing.T) {
+	o := testOrder()
+	o.DateCreated = time.Time{}
+	o.Items = nil
+	got := roundTrip(t, o)
+	if !got.DateCreated.IsZero() {
+		t.Fatalf("zero date_created came back as %v", got.DateCreated)
+	}
+	if got.Items != nil {
+		t.Fatalf("no items came back as %+v", got.Items)
+	}
+	if !reflect.DeepEqual(got, o) {
+		t.Fatalf("got %+v\nwant %+v", got, o)
+	}
+
+	o.Items = []models.Item{}
+	if got := roundTrip(t, o); len(got.Items) != 0 {
+		t.Fatalf("empty items came back as %+v", got.Items)
+	}
+}
+
+func TestRoundTripNonUTC(t *testing.T) {
+	o := testOrder()
+	o.DateCreated = o.DateCreated.In(time.FixedZone("MSK", 3*60*60))
+	if got := roundTrip(t, o); !got.DateCreated.Equal(o.DateCreated) {
+		t.Fatalf("date_created %v, want %v", got.DateCreated, o.DateCreated)
+	}
+}
+
+func TestToModelMissingMessages(t *testing.T) {
+	if got := ToModel(&Order{OrderUid: "a"}); !reflect.DeepEqual(got, models.Order{OrderUID: "a"}) {
+		t.Fatalf("got %+v", got)
+	}
+}
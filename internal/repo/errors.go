@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// IsPermanent reports whether retrying err cannot succeed without changing the
+// data: data exceptions (class 22) and integrity constraint violations (class 23).
+// Connection, resource and concurrency errors are worth retrying.
+func IsPermanent(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || len(pgErr.Code) < 2 {
+		return false
+	}
+	switch pgErr.Code[:2] {
+	case "22", "23":
+		return true
+	}
+	return false
+}
+
+// IsConnection reports whether err means the database could not be reached or
+// went away, as opposed to rejecting the statement: failed dials, broken
+// connections, connection exceptions (class 08) and server shutdowns (57P01-57P03).
+// Such errors say nothing about the data, so they should be retried until the
+// database is back rather than counted against a retry budget.
+func IsConnection(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case len(pgErr.Code) >= 2 && pgErr.Code[:2] == "08":
+			return true
+		case pgErr.Code == "57P01", pgErr.Code == "57P02", pgErr.Code == "57P03":
+			return true
+		}
+		return false
+	}
+	var connErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connErr) || errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		pgconn.SafeToRetry(err) || pgconn.Timeout(err)
+}
@@ -0,0 +1,44 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestErrorClasses(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		err        error
+		permanent  bool
+		connection bool
+	}{
+		{"invalid text representation", &pgconn.PgError{Code: "22P02"}, true, false},
+		{"numeric out of range", &pgconn.PgError{Code: "22003"}, true, false},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, true, false},
+		{"wrapped not null violation", fmt.Errorf("upsert: %w", &pgconn.PgError{Code: "23502"}), true, false},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, false, true},
+		{"connection refused by server", &pgconn.PgError{Code: "08004"}, false, true},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, false, true},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, false, false},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, false, false},
+		{"empty code", &pgconn.PgError{}, false, false},
+		{"dial error", fmt.Errorf("acquire: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), false, true},
+		{"connection closed", io.ErrUnexpectedEOF, false, true},
+		{"deadline", context.DeadlineExceeded, false, true},
+		{"plain error", errors.New("boom"), false, false},
+		{"nil", nil, false, false},
+	} {
+		if got := IsPermanent(tt.err); got != tt.permanent {
+			t.Errorf("%s: IsPermanent = %v, want %v", tt.name, got, tt.permanent)
+		}
+		if got := IsConnection(tt.err); got != tt.connection {
+			t.Errorf("%s: IsConnection = %v, want %v", tt.name, got, tt.connection)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const ordersChannel = "orders_changed"
+
+type OrderChange struct {
+	OrderUID string `json:"order_uid"`
+	// Origin is the instance id of the writer, so it can skip its own notifications.
+	Origin string `json:"origin"`
+}
+
+func (p *PG) InstanceID() string { return p.instance }
+
+// queueOrderChanged notifies listeners, who only hear it once the transaction commits.
+func (p *PG) queueOrderChanged(q *batchQueue, uid string) error {
+	payload, err := json.Marshal(OrderChange{OrderUID: uid, Origin: p.instance})
+	if err != nil {
+		return err
+	}
+	q.queue("notify", `SELECT pg_notify($1, $2)`, ordersChannel, string(payload))
+	return nil
+}
+
+// ListenOrderChanges holds a dedicated connection subscribed to order changes and
+// calls fn for each notification. onListening runs once the subscription is active.
+// It returns when ctx is cancelled or the connection fails; callers reconnect.
+func (p *PG) ListenOrderChanges(ctx context.Context, onListening func(), fn func(OrderChange)) error {
+	conn, err := pgx.ConnectConfig(ctx, p.db.Config().ConnConfig.Copy())
+	if err != nil {
+		return fmt.Errorf("listen connect: %w", err)
+	}
+	defer func() { _ = conn.Close(context.Background()) }()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{ordersChannel}.Sanitize()); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	onListening()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var ch OrderChange
+		if err := json.Unmarshal([]byte(n.Payload), &ch); err != nil || ch.OrderUID == "" {
+			continue
+		}
+		fn(ch)
+	}
+}
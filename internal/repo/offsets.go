@@ -0,0 +1,87 @@
+package repo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrAlreadyApplied means the stored offset is already at or past the one being
+// saved, so the message was processed before.
+var ErrAlreadyApplied = errors.New("kafka offset already applied")
+
+// Offset is the position of the last processed message of a partition.
+type Offset struct {
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+// UpsertOrdersAt is UpsertOrders that also advances the consumer group's offsets
+// in the same transaction. If any offset was already stored nothing is written
+// and ErrAlreadyApplied is returned.
+func (p *PG) UpsertOrdersAt(ctx context.Context, group string, orders []models.Order, at []Offset) error {
+	return p.upsertOrders(ctx, orders, func(tx pgx.Tx) error { return saveOffsets(ctx, tx, group, at) })
+}
+
+// SaveOffsets advances the offsets of messages that did not produce an order.
+// Offsets that are already stored are left alone.
+func (p *PG) SaveOffsets(ctx context.Context, group string, at []Offset) error {
+	tx, err := p.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if err := saveOffsets(ctx, tx, group, at); err != nil && !errors.Is(err, ErrAlreadyApplied) {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Offsets returns the stored offset of every partition of topic for group.
+func (p *PG) Offsets(ctx context.Context, group, topic string) (map[int]int64, error) {
+	rows, err := p.db.Query(ctx, `SELECT kafka_partition, kafka_offset FROM kafka_offsets
+		WHERE consumer_group=$1 AND topic=$2`, group, topic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[int]int64)
+	for rows.Next() {
+		var partition int
+		var offset int64
+		if err := rows.Scan(&partition, &offset); err != nil {
+			return nil, err
+		}
+		out[partition] = offset
+	}
+	return out, rows.Err()
+}
+
+// saveOffsets only moves offsets forward. The row lock taken by the upsert keeps
+// two consumers from applying the same message concurrently.
+func saveOffsets(ctx context.Context, tx pgx.Tx, group string, at []Offset) error {
+	stale := false
+	for _, o := range at {
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO kafka_offsets(consumer_group, topic, kafka_partition, kafka_offset)
+			VALUES($1,$2,$3,$4)
+			ON CONFLICT (consumer_group, topic, kafka_partition) DO UPDATE SET
+			kafka_offset=EXCLUDED.kafka_offset, updated_at=now()
+			WHERE kafka_offsets.kafka_offset < EXCLUDED.kafka_offset`,
+			group, o.Topic, o.Partition, o.Offset)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			stale = true
+		}
+	}
+	if stale {
+		return ErrAlreadyApplied
+	}
+	return nil
+}
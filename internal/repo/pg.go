@@ -2,17 +2,23 @@ package repo
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ratmirtech/techwb-l0/internal/models"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var ErrNotFound = errors.New("order not found")
+
 type PG struct {
-	db *pgxpool.Pool
+	db       *pgxpool.Pool
+	instance string
 }
 
 func New(ctx context.Context, dsn string) (*PG, error) {
@@ -20,19 +26,53 @@ func New(ctx context.Context, dsn string) (*PG, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &PG{db: pool}, nil
+	return &PG{db: pool, instance: uuid.NewString()}, nil
 }
 
 func (p *PG) Close() { p.db.Close() }
 
 func (p *PG) UpsertOrder(ctx context.Context, o models.Order) error {
+	return p.UpsertOrders(ctx, []models.Order{o})
+}
+
+// UpsertOrders saves all orders in one transaction, pipelining the statements in
+// a single round trip. Either every order is stored or none is.
+func (p *PG) UpsertOrders(ctx context.Context, orders []models.Order) error {
+	return p.upsertOrders(ctx, orders, nil)
+}
+
+// upsertOrders runs before, if set, in the transaction ahead of the orders.
+func (p *PG) upsertOrders(ctx context.Context, orders []models.Order, before func(pgx.Tx) error) error {
 	tx, err := p.db.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return err
 	}
 	defer func() { _ = tx.Rollback(ctx) }()
 
-	_, err = tx.Exec(ctx, `
+	if before != nil {
+		if err := before(tx); err != nil {
+			return err
+		}
+	}
+
+	var q batchQueue
+	for _, o := range orders {
+		if err := p.queueOrder(&q, o); err != nil {
+			return err
+		}
+	}
+	if err := q.exec(ctx, tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *PG) queueOrder(q *batchQueue, o models.Order) error {
+	q.queue("orders upsert", `
 		INSERT INTO orders(order_uid, track_number, entry, locale, internal_signature,
 						customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)
 		VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
@@ -40,27 +80,21 @@ func (p *PG) UpsertOrder(ctx context.Context, o models.Order) error {
 		track_number=EXCLUDED.track_number, entry=EXCLUDED.entry, locale=EXCLUDED.locale,
 		internal_signature=EXCLUDED.internal_signature, customer_id=EXCLUDED.customer_id,
 		delivery_service=EXCLUDED.delivery_service, shardkey=EXCLUDED.shardkey, sm_id=EXCLUDED.sm_id,
-		date_created=EXCLUDED.date_created, oof_shard=EXCLUDED.oof_shard
+		date_created=EXCLUDED.date_created, oof_shard=EXCLUDED.oof_shard, updated_at=now()
 `, o.OrderUID, o.TrackNumber, o.Entry, o.Locale, o.InternalSignature,
 		o.CustomerID, o.DeliveryService, o.Shardkey, o.SmID, o.DateCreated, o.OofShard)
-	if err != nil {
-		return fmt.Errorf("orders upsert: %w", err)
-	}
 
 	d := o.Delivery
-	_, err = tx.Exec(ctx, `
+	q.queue("deliveries upsert", `
 		INSERT INTO deliveries(order_uid, name, phone, zip, city, address, region, email)
 		VALUES($1,$2,$3,$4,$5,$6,$7,$8)
 		ON CONFLICT (order_uid) DO UPDATE SET
 		name=EXCLUDED.name, phone=EXCLUDED.phone, zip=EXCLUDED.zip, city=EXCLUDED.city,
 		address=EXCLUDED.address, region=EXCLUDED.region, email=EXCLUDED.email
 `, o.OrderUID, d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email)
-	if err != nil {
-		return fmt.Errorf("deliveries upsert: %w", err)
-	}
 
 	pay := o.Payment
-	_, err = tx.Exec(ctx, `
+	q.queue("payments upsert", `
 		INSERT INTO payments(order_uid, transaction, request_id, currency, provider, amount, payment_dt,
 							bank, delivery_cost, goods_total, custom_fee)
 		VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
@@ -71,30 +105,53 @@ func (p *PG) UpsertOrder(ctx context.Context, o models.Order) error {
 		custom_fee=EXCLUDED.custom_fee
 `, o.OrderUID, pay.Transaction, pay.RequestID, pay.Currency, pay.Provider, pay.Amount,
 		pay.PaymentDt, pay.Bank, pay.DeliveryCost, pay.GoodsTotal, pay.CustomFee)
-	if err != nil {
-		return fmt.Errorf("payments upsert: %w", err)
-	}
 
-	_, err = tx.Exec(ctx, `DELETE FROM items WHERE order_uid=$1`, o.OrderUID)
-	if err != nil {
-		return fmt.Errorf("items delete: %w", err)
-	}
+	q.queue("items delete", `DELETE FROM items WHERE order_uid=$1`, o.OrderUID)
 	for _, it := range o.Items {
-		_, err = tx.Exec(ctx, `
+		q.queue("items insert", `
 		INSERT INTO items(order_uid, chrt_id, track_number, price, rid, name, sale, size,
 						total_price, nm_id, brand, status)
 		VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
 `, o.OrderUID, it.ChrtID, it.TrackNumber, it.Price, it.RID, it.Name, it.Sale,
 			it.Size, it.TotalPrice, it.NmID, it.Brand, it.Status)
+	}
+
+	if len(o.Flags) > 0 {
+		flags, err := json.Marshal(o.Flags)
 		if err != nil {
-			return fmt.Errorf("items insert: %w", err)
+			return err
 		}
+		q.queue("order flags upsert", `
+		INSERT INTO order_flags(order_uid, flags) VALUES($1,$2)
+		ON CONFLICT (order_uid) DO UPDATE SET flags=EXCLUDED.flags, flagged_at=now()
+`, o.OrderUID, flags)
+	} else {
+		q.queue("order flags delete", `DELETE FROM order_flags WHERE order_uid=$1`, o.OrderUID)
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return err
+	return p.queueOrderChanged(q, o.OrderUID)
+}
+
+// batchQueue is a pgx.Batch that remembers what each statement was for error messages.
+type batchQueue struct {
+	b      pgx.Batch
+	labels []string
+}
+
+func (q *batchQueue) queue(label, sql string, args ...any) {
+	q.b.Queue(sql, args...)
+	q.labels = append(q.labels, label)
+}
+
+func (q *batchQueue) exec(ctx context.Context, tx pgx.Tx) error {
+	br := tx.SendBatch(ctx, &q.b)
+	for _, label := range q.labels {
+		if _, err := br.Exec(); err != nil {
+			_ = br.Close()
+			return fmt.Errorf("%s: %w", label, err)
+		}
 	}
-	return nil
+	return br.Close()
 }
 
 func (p *PG) GetOrder(ctx context.Context, id string) (models.Order, error) {
@@ -106,6 +163,9 @@ func (p *PG) GetOrder(ctx context.Context, id string) (models.Order, error) {
 
 	err := row.Scan(&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature,
 		&o.CustomerID, &o.DeliveryService, &o.Shardkey, &o.SmID, &o.DateCreated, &o.OofShard)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return o, ErrNotFound
+	}
 	if err != nil {
 		return o, err
 	}
@@ -129,6 +189,11 @@ func (p *PG) GetOrder(ctx context.Context, id string) (models.Order, error) {
 		return o, err
 	}
 
+	err = p.db.QueryRow(ctx, `SELECT flags FROM order_flags WHERE order_uid=$1`, id).Scan(&o.Flags)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return o, err
+	}
+
 	rows, err := p.db.Query(ctx, `
 		SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
 		FROM items WHERE order_uid=$1 ORDER BY id`, id)
@@ -148,29 +213,136 @@ func (p *PG) GetOrder(ctx context.Context, id string) (models.Order, error) {
 }
 
 func (p *PG) GetAllOrders(ctx context.Context) ([]models.Order, error) {
-	rows, err := p.db.Query(ctx, `SELECT order_uid FROM orders`)
+	return p.queryOrders(ctx, `SELECT `+orderColumns+orderTables+` ORDER BY o.order_uid`)
+}
+
+const itemsBatchSize = 1000
+
+const orderColumns = `
+	o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature, o.customer_id,
+	o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
+	d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
+	p.transaction, p.request_id, p.currency, p.provider, p.amount, p.payment_dt, p.bank,
+	p.delivery_cost, p.goods_total, p.custom_fee, f.flags`
+
+const orderTables = `
+	FROM orders o
+	JOIN deliveries d ON d.order_uid = o.order_uid
+	JOIN payments p ON p.order_uid = o.order_uid
+	LEFT JOIN order_flags f ON f.order_uid = o.order_uid`
+
+func (p *PG) queryOrders(ctx context.Context, sql string, args ...any) ([]models.Order, error) {
+	rows, err := p.db.Query(ctx, sql, args...)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	var ids []string
+	var out []models.Order
 	for rows.Next() {
-		var id string
-		if err := rows.Scan(&id); err != nil {
+		var o models.Order
+		if err := rows.Scan(&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature,
+			&o.CustomerID, &o.DeliveryService, &o.Shardkey, &o.SmID, &o.DateCreated, &o.OofShard,
+			&o.Delivery.Name, &o.Delivery.Phone, &o.Delivery.Zip, &o.Delivery.City,
+			&o.Delivery.Address, &o.Delivery.Region, &o.Delivery.Email,
+			&o.Payment.Transaction, &o.Payment.RequestID, &o.Payment.Currency, &o.Payment.Provider,
+			&o.Payment.Amount, &o.Payment.PaymentDt, &o.Payment.Bank, &o.Payment.DeliveryCost,
+			&o.Payment.GoodsTotal, &o.Payment.CustomFee, &o.Flags); err != nil {
+			rows.Close()
 			return nil, err
 		}
-		ids = append(ids, id)
+		out = append(out, o)
 	}
-	var out []models.Order
-	for _, id := range ids {
-		o, err := p.GetOrder(ctx, id)
-		if err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				continue
-			}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(out); start += itemsBatchSize {
+		end := min(start+itemsBatchSize, len(out))
+		if err := p.loadItems(ctx, out[start:end]); err != nil {
 			return nil, err
 		}
-		out = append(out, o)
 	}
 	return out, nil
 }
+
+func (p *PG) loadItems(ctx context.Context, orders []models.Order) error {
+	ids := make([]string, len(orders))
+	idx := make(map[string]int, len(orders))
+	for i, o := range orders {
+		ids[i] = o.OrderUID
+		idx[o.OrderUID] = i
+	}
+
+	rows, err := p.db.Query(ctx, `
+		SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+		FROM items WHERE order_uid = ANY($1) ORDER BY order_uid, id`, ids)
+	if err != nil {
+		return fmt.Errorf("items batch: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var uid string
+		var it models.Item
+		if err := rows.Scan(&uid, &it.ChrtID, &it.TrackNumber, &it.Price, &it.RID, &it.Name, &it.Sale,
+			&it.Size, &it.TotalPrice, &it.NmID, &it.Brand, &it.Status); err != nil {
+			return err
+		}
+		if i, ok := idx[uid]; ok {
+			orders[i].Items = append(orders[i].Items, it)
+		}
+	}
+	return rows.Err()
+}
+
+func (p *PG) OrdersPage(ctx context.Context, after string, limit int) ([]models.Order, error) {
+	return p.queryOrders(ctx, `SELECT `+orderColumns+orderTables+`
+		WHERE o.order_uid > $1 ORDER BY o.order_uid LIMIT $2`, after, limit)
+}
+
+// FlaggedOrdersPage returns up to limit orders accepted with consistency flags,
+// ordered by order_uid and starting after the given one.
+func (p *PG) FlaggedOrdersPage(ctx context.Context, after string, limit int) ([]models.Order, error) {
+	return p.queryOrders(ctx, `SELECT `+orderColumns+orderTables+`
+		WHERE f.order_uid IS NOT NULL AND o.order_uid > $1 ORDER BY o.order_uid LIMIT $2`, after, limit)
+}
+
+func (p *PG) EachOrdersPage(ctx context.Context, pageSize int, fn func([]models.Order) error) error {
+	return eachPage(pageSize, func(after string) ([]models.Order, error) {
+		return p.OrdersPage(ctx, after, pageSize)
+	}, fn)
+}
+
+func (p *PG) ChangedOrdersPage(ctx context.Context, since time.Time, after string, limit int) ([]models.Order, error) {
+	return p.queryOrders(ctx, `SELECT `+orderColumns+orderTables+`
+		WHERE o.updated_at >= $1 AND o.order_uid > $2 ORDER BY o.order_uid LIMIT $3`, since, after, limit)
+}
+
+// EachChangedOrdersPage walks orders inserted or updated at or after since.
+func (p *PG) EachChangedOrdersPage(ctx context.Context, since time.Time, pageSize int, fn func([]models.Order) error) error {
+	return eachPage(pageSize, func(after string) ([]models.Order, error) {
+		return p.ChangedOrdersPage(ctx, since, after, pageSize)
+	}, fn)
+}
+
+func eachPage(pageSize int, next func(after string) ([]models.Order, error), fn func([]models.Order) error) error {
+	if pageSize <= 0 {
+		return fmt.Errorf("invalid page size %d", pageSize)
+	}
+	after := ""
+	for {
+		page, err := next(after)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(page) < pageSize {
+			return nil
+		}
+		after = page[len(page)-1].OrderUID
+	}
+}
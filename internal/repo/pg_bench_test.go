@@ -0,0 +1,117 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+const benchOrders = 500
+
+// benchPG connects to POSTGRES_DSN and seeds benchOrders orders, which are
+// removed again when the benchmark ends.
+func benchPG(b *testing.B) (*PG, []string) {
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		b.Skip("POSTGRES_DSN is not set")
+	}
+	ctx := context.Background()
+	p, err := New(ctx, dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(p.Close)
+
+	orders := make([]models.Order, benchOrders)
+	ids := make([]string, benchOrders)
+	for i := range orders {
+		orders[i] = benchOrder(fmt.Sprintf("bench-%06d", i))
+		ids[i] = orders[i].OrderUID
+	}
+	if err := p.UpsertOrders(ctx, orders); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		_, _ = p.db.Exec(context.Background(), `DELETE FROM orders WHERE order_uid = ANY($1)`, ids)
+	})
+	return p, ids
+}
+
+func benchOrder(uid string) models.Order {
+	track := "TRACK-" + uid
+	items := make([]models.Item, 3)
+	for i := range items {
+		items[i] = models.Item{ChrtID: i + 1, TrackNumber: track, Price: 100, Name: "item",
+			TotalPrice: 100, NmID: i + 1, Brand: "brand", Status: 202}
+	}
+	return models.Order{
+		OrderUID:    uid,
+		TrackNumber: track,
+		Entry:       "WBIL",
+		Delivery:    models.Delivery{Name: "Test", Phone: "+9720000000", City: "City", Address: "Street 1"},
+		Payment:     models.Payment{Transaction: uid, Currency: "USD", Provider: "wbpay", Amount: 300, GoodsTotal: 300},
+		Items:       items,
+		Locale:      "en",
+		CustomerID:  "test",
+		DateCreated: time.Now().UTC(),
+	}
+}
+
+// BenchmarkLoadOrders compares loading orders one GetOrder at a time, as
+// warm-up used to, with the paged and full loads the cache warm-up uses now.
+func BenchmarkLoadOrders(b *testing.B) {
+	p, ids := benchPG(b)
+	ctx := context.Background()
+
+	b.Run("per-order", func(b *testing.B) {
+		for b.Loop() {
+			for _, id := range ids {
+				if _, err := p.GetOrder(ctx, id); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("page", func(b *testing.B) {
+		// the seeded ids sort right after their common prefix
+		for b.Loop() {
+			orders, err := p.OrdersPage(ctx, "bench-", len(ids))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(orders) != len(ids) {
+				b.Fatalf("loaded %d orders, want %d", len(orders), len(ids))
+			}
+		}
+	})
+	b.Run("each-page", func(b *testing.B) {
+		for b.Loop() {
+			n := 0
+			err := p.EachOrdersPage(ctx, 100, func(orders []models.Order) error {
+				n += len(orders)
+				return nil
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if n < len(ids) {
+				b.Fatalf("walked %d orders, want at least %d", n, len(ids))
+			}
+		}
+	})
+	b.Run("all", func(b *testing.B) {
+		for b.Loop() {
+			orders, err := p.GetAllOrders(ctx)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(orders) < len(ids) {
+				b.Fatalf("loaded %d orders, want at least %d", len(orders), len(ids))
+			}
+		}
+	})
+}
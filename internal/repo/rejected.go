@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrRejectedNotFound = errors.New("rejected message not found")
+
+const rejectedColumns = `id, topic, kafka_partition, kafka_offset, msg_key, content_type, payload, reason,
+	error, received_at, resubmitted_at, resubmit_error`
+
+// SaveRejected is idempotent per topic/partition/offset, so redeliveries keep the first record.
+func (p *PG) SaveRejected(ctx context.Context, m models.RejectedMessage) error {
+	_, err := p.db.Exec(ctx, `
+		INSERT INTO rejected_messages(topic, kafka_partition, kafka_offset, msg_key, content_type, payload,
+			reason, error)
+		VALUES($1,$2,$3,$4,$5,$6,$7,$8)
+		ON CONFLICT (topic, kafka_partition, kafka_offset) DO NOTHING`,
+		m.Topic, m.Partition, m.Offset, []byte(m.Key), m.ContentType, m.Payload, m.Reason, m.Error)
+	return err
+}
+
+// ListRejected returns up to limit messages with id below before, newest first.
+// A non-positive before starts from the newest.
+func (p *PG) ListRejected(ctx context.Context, before int64, limit int) ([]models.RejectedMessage, error) {
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+	rows, err := p.db.Query(ctx, `SELECT `+rejectedColumns+`
+		FROM rejected_messages WHERE id < $1 ORDER BY id DESC LIMIT $2`, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []models.RejectedMessage{}
+	for rows.Next() {
+		m, err := scanRejected(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func (p *PG) GetRejected(ctx context.Context, id int64) (models.RejectedMessage, error) {
+	m, err := scanRejected(p.db.QueryRow(ctx, `SELECT `+rejectedColumns+`
+		FROM rejected_messages WHERE id=$1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return m, ErrRejectedNotFound
+	}
+	return m, err
+}
+
+// MarkResubmitted records a resubmission attempt; a nil cause means it succeeded.
+func (p *PG) MarkResubmitted(ctx context.Context, id int64, cause error) error {
+	var msg *string
+	if cause != nil {
+		s := cause.Error()
+		msg = &s
+	}
+	_, err := p.db.Exec(ctx, `
+		UPDATE rejected_messages SET resubmitted_at=now(), resubmit_error=$2 WHERE id=$1`, id, msg)
+	return err
+}
+
+func scanRejected(row pgx.Row) (models.RejectedMessage, error) {
+	var (
+		m   models.RejectedMessage
+		key []byte
+	)
+	err := row.Scan(&m.ID, &m.Topic, &m.Partition, &m.Offset, &key, &m.ContentType, &m.Payload, &m.Reason,
+		&m.Error, &m.ReceivedAt, &m.ResubmittedAt, &m.ResubmitError)
+	m.Key = string(key)
+	return m, err
+}
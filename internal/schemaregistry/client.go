@@ -0,0 +1,132 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+var (
+	ErrNotFound = errors.New("schema not found")
+	// ErrUnavailable is a transport failure or a 5xx answer, worth retrying.
+	ErrUnavailable = errors.New("schema registry unavailable")
+)
+
+// Client talks to a Confluent-compatible schema registry. Schemas never change
+// once registered, so lookups by id and registrations are cached for good.
+type Client struct {
+	baseURL string
+	http    *http.Client
+
+	mu      sync.RWMutex
+	byID    map[int]string
+	idByKey map[string]int // subject + "\x00" + schema
+}
+
+func New(baseURL string) *Client {
+	return NewWithHTTPClient(baseURL, &http.Client{Timeout: 10 * time.Second})
+}
+
+func NewWithHTTPClient(baseURL string, hc *http.Client) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    hc,
+		byID:    make(map[int]string),
+		idByKey: make(map[string]int),
+	}
+}
+
+// Schema returns the schema registered under id.
+func (c *Client) Schema(ctx context.Context, id int) (string, error) {
+	c.mu.RLock()
+	s, ok := c.byID[id]
+	c.mu.RUnlock()
+	if ok {
+		return s, nil
+	}
+
+	var resp struct {
+		Schema string `json:"schema"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &resp); err != nil {
+		return "", fmt.Errorf("schema %d: %w", id, err)
+	}
+	c.mu.Lock()
+	c.byID[id] = resp.Schema
+	c.mu.Unlock()
+	return resp.Schema, nil
+}
+
+// Register registers schema under subject, or finds it if it already is, and
+// returns its id.
+func (c *Client) Register(ctx context.Context, subject, schema string) (int, error) {
+	key := subject + "\x00" + schema
+	c.mu.RLock()
+	id, ok := c.idByKey[key]
+	c.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	req := struct {
+		Schema string `json:"schema"`
+	}{schema}
+	var resp struct {
+		ID int `json:"id"`
+	}
+	path := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if err := c.do(ctx, http.MethodPost, path, req, &resp); err != nil {
+		return 0, fmt.Errorf("register %s: %w", subject, err)
+	}
+	c.mu.Lock()
+	c.idByKey[key] = resp.ID
+	c.byID[resp.ID] = schema
+	c.mu.Unlock()
+	return resp.ID, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", contentType)
+	if in != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%w: %s", ErrUnavailable, resp.Status)
+	case resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("schema registry: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
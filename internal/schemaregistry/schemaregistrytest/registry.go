@@ -0,0 +1,81 @@
+// Package schemaregistrytest provides an in-memory schema registry for tests.
+package schemaregistrytest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	"github.com/ratmirtech/techwb-l0/internal/schemaregistry"
+)
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// Registry serves the endpoints schemaregistry.Client uses from memory.
+type Registry struct {
+	mu      sync.Mutex
+	mux     *http.ServeMux
+	schemas []string       // id-1 -> schema
+	ids     map[string]int // subject + "\x00" + schema -> id
+}
+
+func New() *Registry {
+	reg := &Registry{mux: http.NewServeMux(), ids: make(map[string]int)}
+	reg.mux.HandleFunc("GET /schemas/ids/{id}", reg.handleSchema)
+	reg.mux.HandleFunc("POST /subjects/{subject}/versions", reg.handleRegister)
+	return reg
+}
+
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) { reg.mux.ServeHTTP(w, r) }
+
+// Client returns a client that calls reg directly, without a network listener.
+func (reg *Registry) Client() *schemaregistry.Client {
+	return schemaregistry.NewWithHTTPClient("http://fake-registry", &http.Client{Transport: handlerTransport{reg}})
+}
+
+func (reg *Registry) handleSchema(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if err != nil || id < 1 || id > len(reg.schemas) {
+		write(w, http.StatusNotFound, map[string]any{"error_code": 40403, "message": "Schema not found"})
+		return
+	}
+	write(w, http.StatusOK, map[string]string{"schema": reg.schemas[id-1]})
+}
+
+func (reg *Registry) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Schema == "" {
+		write(w, http.StatusUnprocessableEntity, map[string]any{"error_code": 42201, "message": "Invalid schema"})
+		return
+	}
+	key := r.PathValue("subject") + "\x00" + req.Schema
+	reg.mu.Lock()
+	id, ok := reg.ids[key]
+	if !ok {
+		reg.schemas = append(reg.schemas, req.Schema)
+		id = len(reg.schemas)
+		reg.ids[key] = id
+	}
+	reg.mu.Unlock()
+	write(w, http.StatusOK, map[string]int{"id": id})
+}
+
+func write(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type handlerTransport struct{ h http.Handler }
+
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.h.ServeHTTP(rec, r)
+	return rec.Result(), nil
+}
@@ -0,0 +1,52 @@
+package validation
+
+import (
+	"fmt"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+// How an order that fails Reconcile is handled.
+const (
+	ReconcileReject = "reject"
+	ReconcileFlag   = "flag"
+	ReconcileIgnore = "ignore"
+)
+
+// Reconcile checks that the payment adds up: every item total is its price with
+// the sale applied, goods_total is the sum of item totals and amount is
+// goods_total plus delivery_cost and custom_fee.
+func Reconcile(o models.Order) Errors {
+	v := &validator{}
+	p := o.Payment
+
+	sum := 0
+	for i, it := range o.Items {
+		sum += it.TotalPrice
+		// total_price may be rounded either way, so allow less than one unit off
+		if diff := it.TotalPrice*100 - it.Price*(100-it.Sale); diff <= -100 || diff >= 100 {
+			v.add(fmt.Sprintf("items[%d].total_price", i),
+				fmt.Sprintf("is %d, price %d with sale %d%% gives %d", it.TotalPrice, it.Price, it.Sale,
+					it.Price*(100-it.Sale)/100))
+		}
+	}
+	if p.GoodsTotal != sum {
+		v.add("payment.goods_total", fmt.Sprintf("is %d, items add up to %d", p.GoodsTotal, sum))
+	}
+	if want := p.GoodsTotal + p.DeliveryCost + p.CustomFee; p.Amount != want {
+		v.add("payment.amount", fmt.Sprintf("is %d, goods_total + delivery_cost + custom_fee is %d", p.Amount, want))
+	}
+	return v.errs
+}
+
+// Flags turns reconciliation errors into flags stored with the order.
+func (e Errors) Flags() []models.Flag {
+	if len(e) == 0 {
+		return nil
+	}
+	out := make([]models.Flag, len(e))
+	for i, fe := range e {
+		out[i] = models.Flag{Field: fe.Field, Message: fe.Message}
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+package validation
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+func TestReconcile(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		change func(o *models.Order)
+		fields []string
+	}{
+		{"consistent", func(*models.Order) {}, nil},
+		// 453 with 30% off is 317.1
+		{"total rounded up", func(o *models.Order) {
+			o.Items[0].TotalPrice, o.Payment.GoodsTotal, o.Payment.Amount = 318, 318, 1818
+		}, nil},
+		{"total a unit off", func(o *models.Order) {
+			o.Items[0].TotalPrice, o.Payment.GoodsTotal, o.Payment.Amount = 319, 319, 1819
+		}, []string{"items[0].total_price"}},
+		{"total without sale", func(o *models.Order) {
+			o.Items[0].TotalPrice, o.Payment.GoodsTotal, o.Payment.Amount = 453, 453, 1953
+		}, []string{"items[0].total_price"}},
+		{"full sale", func(o *models.Order) {
+			o.Items[0].Sale, o.Items[0].TotalPrice, o.Payment.GoodsTotal, o.Payment.Amount = 100, 0, 0, 1500
+		}, nil},
+		{"goods_total", func(o *models.Order) { o.Payment.GoodsTotal, o.Payment.Amount = 300, 1800 },
+			[]string{"payment.goods_total"}},
+		{"amount", func(o *models.Order) { o.Payment.Amount = 1800 }, []string{"payment.amount"}},
+		{"custom fee counts", func(o *models.Order) { o.Payment.CustomFee, o.Payment.Amount = 50, 1867 }, nil},
+		{"custom fee missing from amount", func(o *models.Order) { o.Payment.CustomFee = 50 }, []string{"payment.amount"}},
+		{"second item", func(o *models.Order) {
+			o.Items = append(o.Items, models.Item{Price: 100, Sale: 0, TotalPrice: 100})
+			o.Payment.GoodsTotal, o.Payment.Amount = 417, 1917
+		}, nil},
+		{"second item left out", func(o *models.Order) {
+			o.Items = append(o.Items, models.Item{Price: 100, Sale: 0, TotalPrice: 100})
+		}, []string{"payment.goods_total"}},
+		{"no items", func(o *models.Order) { o.Items = nil }, []string{"payment.goods_total"}},
+	} {
+		o := testOrder()
+		tt.change(&o)
+		var got []string
+		for _, fe := range Reconcile(o) {
+			got = append(got, fe.Field)
+		}
+		if !slices.Equal(got, tt.fields) {
+			t.Errorf("%s: failed %v, want %v", tt.name, got, tt.fields)
+		}
+	}
+}
+
+func TestReconcileMessages(t *testing.T) {
+	o := testOrder()
+	o.Items[0].TotalPrice = 453
+	want := Errors{
+		{"items[0].total_price", "is 453, price 453 with sale 30% gives 317"},
+		{"payment.goods_total", "is 317, items add up to 453"},
+	}
+	if got := Reconcile(o); !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	if f := Errors(nil).Flags(); f != nil {
+		t.Fatalf("no errors gave flags %v", f)
+	}
+	errs := Errors{{"payment.amount", "is 1, goods_total + delivery_cost + custom_fee is 2"}, {"items[1].total_price", "is 5"}}
+	want := []models.Flag{{Field: "payment.amount", Message: "is 1, goods_total + delivery_cost + custom_fee is 2"}, {Field: "items[1].total_price", Message: "is 5"}}
+	if got := errs.Flags(); !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,143 @@
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+)
+
+// FieldError is one failed check; Field is the JSON path, e.g. items[0].price.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string { return e.Field + ": " + e.Message }
+
+// Errors lists every failed check of an order.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Error()
+	}
+	return strings.Join(parts, "; ")
+}
+
+var phoneRe = regexp.MustCompile(`^\+?[0-9]{10,15}$`)
+
+// Order returns nil when o is valid.
+func Order(o models.Order) Errors {
+	v := &validator{}
+
+	v.required("order_uid", o.OrderUID)
+	v.required("track_number", o.TrackNumber)
+	v.required("entry", o.Entry)
+	v.required("customer_id", o.CustomerID)
+	v.required("delivery_service", o.DeliveryService)
+	v.locale("locale", o.Locale)
+	if o.DateCreated.IsZero() {
+		v.add("date_created", "is required")
+	}
+
+	d := o.Delivery
+	v.required("delivery.name", d.Name)
+	v.required("delivery.city", d.City)
+	v.required("delivery.address", d.Address)
+	if v.required("delivery.phone", d.Phone) && !phoneRe.MatchString(d.Phone) {
+		v.add("delivery.phone", "must be 10 to 15 digits with an optional leading +")
+	}
+	if d.Email != "" {
+		if a, err := mail.ParseAddress(d.Email); err != nil || a.Address != d.Email {
+			v.add("delivery.email", "is not a valid email address")
+		}
+	}
+
+	p := o.Payment
+	v.required("payment.transaction", p.Transaction)
+	v.required("payment.provider", p.Provider)
+	v.currency("payment.currency", p.Currency)
+	v.nonNegative("payment.amount", p.Amount)
+	v.nonNegative("payment.delivery_cost", p.DeliveryCost)
+	v.nonNegative("payment.goods_total", p.GoodsTotal)
+	v.nonNegative("payment.custom_fee", p.CustomFee)
+	if p.PaymentDt < 0 {
+		v.add("payment.payment_dt", "must not be negative")
+	}
+
+	if len(o.Items) == 0 {
+		v.add("items", "must contain at least one item")
+	}
+	for i, it := range o.Items {
+		f := fmt.Sprintf("items[%d].", i)
+		v.required(f+"name", it.Name)
+		if it.ChrtID <= 0 {
+			v.add(f+"chrt_id", "must be positive")
+		}
+		if it.NmID <= 0 {
+			v.add(f+"nm_id", "must be positive")
+		}
+		if it.TrackNumber != o.TrackNumber {
+			v.add(f+"track_number", "must match the order track_number")
+		}
+		v.nonNegative(f+"price", it.Price)
+		v.nonNegative(f+"total_price", it.TotalPrice)
+		if it.Sale < 0 || it.Sale > 100 {
+			v.add(f+"sale", "must be a percentage between 0 and 100")
+		}
+	}
+
+	return v.errs
+}
+
+type validator struct {
+	errs Errors
+}
+
+func (v *validator) add(field, msg string) {
+	v.errs = append(v.errs, FieldError{Field: field, Message: msg})
+}
+
+// required reports whether s is set, recording an error when it is not.
+func (v *validator) required(field, s string) bool {
+	if strings.TrimSpace(s) == "" {
+		v.add(field, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) nonNegative(field string, n int) {
+	if n < 0 {
+		v.add(field, "must not be negative")
+	}
+}
+
+func (v *validator) currency(field, code string) {
+	if !v.required(field, code) {
+		return
+	}
+	if code != strings.ToUpper(code) {
+		v.add(field, "must be an upper-case ISO 4217 code")
+		return
+	}
+	if _, err := currency.ParseISO(code); err != nil {
+		v.add(field, "is not an ISO 4217 currency code")
+	}
+}
+
+func (v *validator) locale(field, tag string) {
+	if !v.required(field, tag) {
+		return
+	}
+	if t, err := language.Parse(tag); err != nil || t == language.Und {
+		v.add(field, "is not a valid locale code")
+	}
+}
@@ -0,0 +1,166 @@
+package validation
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ratmirtech/techwb-l0/internal/models"
+)
+
+// testOrder is the order from the task statement: valid and reconciled.
+func testOrder() models.Order {
+	return models.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction: "b563feb7b2b84b6test", Currency: "USD", Provider: "wbpay",
+			Amount: 1817, PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317,
+		},
+		Items: []models.Item{{
+			ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, RID: "ab4219087a764ae0btest",
+			Name: "Mascaras", Sale: 30, TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202,
+		}},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+	}
+}
+
+// ruleCase changes a valid order and lists the fields that must then fail,
+// none for a change that keeps the order valid.
+type ruleCase struct {
+	name   string
+	change func(o *models.Order)
+	fields []string
+}
+
+func checkRules(t *testing.T, tests []ruleCase) {
+	t.Helper()
+	for _, tt := range tests {
+		o := testOrder()
+		tt.change(&o)
+		var got []string
+		for _, fe := range Order(o) {
+			got = append(got, fe.Field)
+		}
+		if !slices.Equal(got, tt.fields) {
+			t.Errorf("%s: failed %v, want %v", tt.name, got, tt.fields)
+		}
+	}
+}
+
+func TestValidOrder(t *testing.T) {
+	if errs := Order(testOrder()); errs != nil {
+		t.Fatalf("valid order failed: %v", errs)
+	}
+}
+
+func TestRequired(t *testing.T) {
+	checkRules(t, []ruleCase{
+		{"order_uid", func(o *models.Order) { o.OrderUID = "" }, []string{"order_uid"}},
+		{"blank track_number", func(o *models.Order) { o.TrackNumber, o.Items[0].TrackNumber = "  ", "  " }, []string{"track_number"}},
+		{"entry", func(o *models.Order) { o.Entry = "" }, []string{"entry"}},
+		{"customer_id", func(o *models.Order) { o.CustomerID = "" }, []string{"customer_id"}},
+		{"delivery_service", func(o *models.Order) { o.DeliveryService = "" }, []string{"delivery_service"}},
+		{"delivery fields", func(o *models.Order) { o.Delivery = models.Delivery{} },
+			[]string{"delivery.name", "delivery.city", "delivery.address", "delivery.phone"}},
+		{"payment fields", func(o *models.Order) { o.Payment.Transaction, o.Payment.Provider = "", "\t" },
+			[]string{"payment.transaction", "payment.provider"}},
+		{"optional fields", func(o *models.Order) {
+			o.Delivery.Zip, o.Delivery.Region, o.Delivery.Email = "", "", ""
+			o.Payment.Bank, o.Payment.RequestID = "", ""
+			o.InternalSignature, o.Shardkey, o.OofShard = "", "", ""
+		}, nil},
+		{"no items", func(o *models.Order) { o.Items = nil }, []string{"items"}},
+		{"item name", func(o *models.Order) { o.Items[0].Name = "" }, []string{"items[0].name"}},
+	})
+}
+
+func TestPhone(t *testing.T) {
+	checkRules(t, []ruleCase{
+		{"10 digits", func(o *models.Order) { o.Delivery.Phone = "9720000000" }, nil},
+		{"15 digits with +", func(o *models.Order) { o.Delivery.Phone = "+" + strings.Repeat("7", 15) }, nil},
+		{"9 digits", func(o *models.Order) { o.Delivery.Phone = "+972000000" }, []string{"delivery.phone"}},
+		{"16 digits", func(o *models.Order) { o.Delivery.Phone = strings.Repeat("7", 16) }, []string{"delivery.phone"}},
+		{"separators", func(o *models.Order) { o.Delivery.Phone = "+972-000-0000" }, []string{"delivery.phone"}},
+		{"letters", func(o *models.Order) { o.Delivery.Phone = "+97200000ab" }, []string{"delivery.phone"}},
+		{"plus inside", func(o *models.Order) { o.Delivery.Phone = "972+0000000" }, []string{"delivery.phone"}},
+		{"missing", func(o *models.Order) { o.Delivery.Phone = "" }, []string{"delivery.phone"}},
+	})
+}
+
+func TestEmail(t *testing.T) {
+	checkRules(t, []ruleCase{
+		{"subdomain", func(o *models.Order) { o.Delivery.Email = "test@mail.example.com" }, nil},
+		{"no at", func(o *models.Order) { o.Delivery.Email = "test.gmail.com" }, []string{"delivery.email"}},
+		{"no domain", func(o *models.Order) { o.Delivery.Email = "test@" }, []string{"delivery.email"}},
+		{"display name", func(o *models.Order) { o.Delivery.Email = "Test <test@gmail.com>" }, []string{"delivery.email"}},
+		{"spaces", func(o *models.Order) { o.Delivery.Email = " test@gmail.com" }, []string{"delivery.email"}},
+	})
+}
+
+func TestPayment(t *testing.T) {
+	checkRules(t, []ruleCase{
+		{"other currency", func(o *models.Order) { o.Payment.Currency = "RUB" }, nil},
+		{"lower-case currency", func(o *models.Order) { o.Payment.Currency = "usd" }, []string{"payment.currency"}},
+		{"unknown currency", func(o *models.Order) { o.Payment.Currency = "XYZ" }, []string{"payment.currency"}},
+		{"missing currency", func(o *models.Order) { o.Payment.Currency = "" }, []string{"payment.currency"}},
+		{"zero amounts", func(o *models.Order) {
+			o.Payment.Amount, o.Payment.DeliveryCost, o.Payment.GoodsTotal, o.Payment.CustomFee = 0, 0, 0, 0
+		}, nil},
+		{"negative amounts", func(o *models.Order) {
+			o.Payment.Amount, o.Payment.DeliveryCost, o.Payment.GoodsTotal, o.Payment.CustomFee = -1, -1, -1, -1
+		}, []string{"payment.amount", "payment.delivery_cost", "payment.goods_total", "payment.custom_fee"}},
+	})
+}
+
+func TestItems(t *testing.T) {
+	checkRules(t, []ruleCase{
+		{"sale 0", func(o *models.Order) { o.Items[0].Sale = 0 }, nil},
+		{"sale 100", func(o *models.Order) { o.Items[0].Sale = 100 }, nil},
+		{"sale 101", func(o *models.Order) { o.Items[0].Sale = 101 }, []string{"items[0].sale"}},
+		{"sale -1", func(o *models.Order) { o.Items[0].Sale = -1 }, []string{"items[0].sale"}},
+		{"zero prices", func(o *models.Order) { o.Items[0].Price, o.Items[0].TotalPrice = 0, 0 }, nil},
+		{"negative prices", func(o *models.Order) { o.Items[0].Price, o.Items[0].TotalPrice = -1, -1 },
+			[]string{"items[0].price", "items[0].total_price"}},
+		{"ids", func(o *models.Order) { o.Items[0].ChrtID, o.Items[0].NmID = 0, -1 },
+			[]string{"items[0].chrt_id", "items[0].nm_id"}},
+		{"foreign track", func(o *models.Order) { o.Items[0].TrackNumber = "OTHER" }, []string{"items[0].track_number"}},
+		{"second item", func(o *models.Order) {
+			it := o.Items[0]
+			it.ChrtID = 0
+			o.Items = append(o.Items, it)
+		}, []string{"items[1].chrt_id"}},
+	})
+}
+
+func TestLocaleAndTimestamps(t *testing.T) {
+	checkRules(t, []ruleCase{
+		{"region locale", func(o *models.Order) { o.Locale = "ru-RU" }, nil},
+		{"bad locale", func(o *models.Order) { o.Locale = "not a locale" }, []string{"locale"}},
+		{"undetermined locale", func(o *models.Order) { o.Locale = "und" }, []string{"locale"}},
+		{"missing locale", func(o *models.Order) { o.Locale = "" }, []string{"locale"}},
+		{"zero date_created", func(o *models.Order) { o.DateCreated = time.Time{} }, []string{"date_created"}},
+		{"epoch date_created", func(o *models.Order) { o.DateCreated = time.Unix(0, 0) }, nil},
+		{"payment_dt 0", func(o *models.Order) { o.Payment.PaymentDt = 0 }, nil},
+		{"payment_dt -1", func(o *models.Order) { o.Payment.PaymentDt = -1 }, []string{"payment.payment_dt"}},
+	})
+}
+
+func TestErrorsMessage(t *testing.T) {
+	o := testOrder()
+	o.OrderUID, o.Items[0].Sale = "", 101
+	errs := Order(o)
+	want := "order_uid: is required; items[0].sale: must be a percentage between 0 and 100"
+	if errs.Error() != want {
+		t.Fatalf("got %q, want %q", errs.Error(), want)
+	}
+}
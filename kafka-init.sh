@@ -3,4 +3,9 @@ kafka-topics.sh --bootstrap-server localhost:9092 \
   --create --if-not-exists \
   --topic orders \
   --partitions 1 \
-  --replication-factor 1
\ No newline at end of file
+  --replication-factor 1
+kafka-topics.sh --bootstrap-server localhost:9092 \
+  --create --if-not-exists \
+  --topic orders-dlq \
+  --partitions 1 \
+  --replication-factor 1
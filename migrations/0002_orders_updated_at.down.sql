@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS orders_updated_at_idx;
+ALTER TABLE orders DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS rejected_messages (
+    id BIGSERIAL PRIMARY KEY,
+    topic TEXT NOT NULL,
+    kafka_partition INT NOT NULL,
+    kafka_offset BIGINT NOT NULL,
+    msg_key BYTEA,
+    payload BYTEA NOT NULL,
+    reason TEXT NOT NULL,
+    error TEXT NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    resubmitted_at TIMESTAMPTZ,
+    resubmit_error TEXT,
+    UNIQUE (topic, kafka_partition, kafka_offset)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS kafka_offsets (
+    consumer_group TEXT NOT NULL,
+    topic TEXT NOT NULL,
+    kafka_partition INT NOT NULL,
+    kafka_offset BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (consumer_group, topic, kafka_partition)
+);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS order_flags (
+    order_uid TEXT PRIMARY KEY REFERENCES orders(order_uid) ON DELETE CASCADE,
+    flags JSONB NOT NULL,
+    flagged_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
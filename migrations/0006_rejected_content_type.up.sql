@@ -0,0 +1 @@
+ALTER TABLE rejected_messages ADD COLUMN IF NOT EXISTS content_type TEXT NOT NULL DEFAULT '';